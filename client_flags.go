@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// clientFlags are the flags every command needs to talk to the Netatmo API.
+type clientFlags struct {
+	clientID     string
+	clientSecret string
+	username     string
+	password     string
+	refreshToken string
+	concurrency  int
+	tokenStoreFlags
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.clientID, "client-id", "", "Netatmo API client ID")
+	fs.StringVar(&f.clientSecret, "client-secret", "", "Netatmo API client secret")
+	fs.StringVar(&f.username, "username", "", "Netatmo username")
+	fs.StringVar(&f.password, "password", "", "Netatmo password")
+	fs.StringVar(&f.refreshToken, "refresh-token", "", "Netatmo refresh-token")
+	f.tokenStoreFlags.register(fs)
+	fs.IntVar(&f.concurrency, "homestatus.concurrency", 4, "Maximum number of home statuses fetched at the same time")
+}
+
+func (f *clientFlags) validate() error {
+	if f.clientID == "" {
+		return errors.New("netatmo API client ID has to be provided")
+	}
+
+	if f.clientSecret == "" {
+		return errors.New("netatmo API client secret has to be provided")
+	}
+
+	// the token file is checked when the client is created, as it may have
+	// been written by the login command instead of the credentials here
+	if f.tokenFile != "" {
+		return nil
+	}
+
+	refreshTokenUsed := false
+	if f.refreshToken != "" {
+		refreshTokenUsed = true
+	}
+
+	if f.username == "" && !refreshTokenUsed {
+		return errors.New("netatmo username has to be provided")
+	}
+
+	if f.password == "" && !refreshTokenUsed {
+		return errors.New("netatmo password has to be provided")
+	}
+
+	return nil
+}
+
+// newClient validates the flags and creates a client requesting the given
+// scopes.
+func (f *clientFlags) newClient(ctx context.Context, scopes ...string) (*netatmo.Client, error) {
+	if err := f.validate(); err != nil {
+		return nil, err
+	}
+
+	cnf := &netatmo.Config{
+		ClientID:     f.clientID,
+		ClientSecret: f.clientSecret,
+		Username:     f.username,
+		Password:     f.password,
+		RefreshToken: f.refreshToken,
+		Scopes:       scopes,
+
+		HomeStatusConcurrency: f.concurrency,
+	}
+	if f.tokenFile != "" {
+		store, err := f.store()
+		if err != nil {
+			return nil, err
+		}
+		cnf.TokenStore = store
+	}
+	return netatmo.NewClient(ctx, cnf)
+}
@@ -0,0 +1,96 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// boilerModuleTypes are the modules which switch a boiler and therefore
+// have a boiler history.
+var boilerModuleTypes = map[string]bool{
+	"NATherm1": true,
+	"OTM":      true,
+}
+
+// boilerCollector exports how long boilers were switched on and off, based
+// on the measure history of their thermostats.
+type boilerCollector struct {
+	history   *measureHistory
+	boilerOn  *prometheus.Desc
+	boilerOff *prometheus.Desc
+}
+
+func newBoilerCollector(client netatmo.API, o *options) subsystem {
+	return &boilerCollector{
+		history: newMeasureHistory(client, netatmo.MeasureSumBoilerOn, netatmo.MeasureSumBoilerOff),
+
+		boilerOn: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "boiler_on_seconds_total"),
+			"Time the boiler was switched on",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		boilerOff: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "boiler_off_seconds_total"),
+			"Time the boiler was switched off",
+			moduleLabelNames,
+			o.constLabels,
+		),
+	}
+}
+
+func (c *boilerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.boilerOn
+	ch <- c.boilerOff
+}
+
+func (c *boilerCollector) Update(s *scrape, ch chan<- prometheus.Metric) error {
+	homes, err := s.Homes()
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, home := range homes.Homes {
+		labelsHome := homeLabels(home)
+
+		for _, m := range home.Modules {
+			if !boilerModuleTypes[m.Type] || m.Bridge == "" {
+				continue
+			}
+
+			sums, err := c.history.update(m, s.now)
+			if err != nil {
+				lastErr = fmt.Errorf("module %s: %w", m.Id, err)
+				continue
+			}
+
+			labelsModule := append(
+				labelsHome,
+				m.RoomId,
+				m.Bridge,
+				m.Id,
+				m.Type,
+			)
+
+			ch <- prometheus.MustNewConstMetric(
+				c.boilerOn,
+				prometheus.CounterValue,
+				sums[netatmo.MeasureSumBoilerOn],
+				labelsModule...,
+			)
+
+			ch <- prometheus.MustNewConstMetric(
+				c.boilerOff,
+				prometheus.CounterValue,
+				sums[netatmo.MeasureSumBoilerOff],
+				labelsModule...,
+			)
+		}
+	}
+
+	return lastErr
+}
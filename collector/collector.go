@@ -0,0 +1,473 @@
+package collector
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultNamespace = "netatmo"
+	subsystemHome    = "home"
+	subsystemModule  = "module"
+	subsystemRoom    = "room"
+	subsystemScrape  = "scrape"
+)
+
+var (
+	homeLabelNames = []string{
+		"home_id",
+		"home_name",
+		"home_country",
+		"home_altitude",
+		"home_lat",
+		"home_long",
+	}
+
+	roomLabelNames = append(
+		homeLabelNames,
+		"room_id",
+	)
+
+	moduleLabelNames = append(
+		roomLabelNames,
+		"bridge",
+		"module",
+		"type",
+	)
+
+	// deviceLabelNames are the labels of devices which are not part of an
+	// energy home, like weather stations.
+	deviceLabelNames = append(
+		homeLabelNames,
+		"bridge",
+		"module",
+		"type",
+	)
+)
+
+// subsystem is a group of metrics, e.g. the rooms of energy homes or
+// weather stations, which can be enabled on its own.
+type subsystem interface {
+	// Describe sends the descriptors of all metrics Update may send.
+	Describe(ch chan<- *prometheus.Desc)
+
+	// Update sends the metrics of the subsystem to ch.
+	Update(s *scrape, ch chan<- prometheus.Metric) error
+}
+
+// collectorEntry describes a subsystem which can be enabled by its name.
+type collectorEntry struct {
+	name           string
+	defaultEnabled bool
+	scopes         []string
+	factory        func(client netatmo.API, o *options) subsystem
+}
+
+// collectors are all available subsystems.
+var collectors = []*collectorEntry{
+	{
+		name:           "energy_homes",
+		defaultEnabled: true,
+		scopes:         []string{netatmo.ReadThermostat},
+		factory:        newHomesCollector,
+	},
+	{
+		name:           "energy_rooms",
+		defaultEnabled: true,
+		scopes:         []string{netatmo.ReadThermostat},
+		factory:        newRoomsCollector,
+	},
+	{
+		name:           "energy_modules",
+		defaultEnabled: true,
+		scopes:         []string{netatmo.ReadThermostat},
+		factory:        newModulesCollector,
+	},
+	{
+		name:           "boiler_history",
+		defaultEnabled: false,
+		scopes:         []string{netatmo.ReadThermostat},
+		factory:        newBoilerCollector,
+	},
+	{
+		name:           "energy_meters",
+		defaultEnabled: false,
+		scopes:         []string{netatmo.ReadMagellan},
+		factory:        newMeterCollector,
+	},
+	{
+		name:           "schedules",
+		defaultEnabled: true,
+		scopes:         []string{netatmo.ReadThermostat},
+		factory:        newScheduleCollector,
+	},
+	{
+		name:           "weather",
+		defaultEnabled: true,
+		scopes:         []string{netatmo.ReadStation},
+		factory:        newWeatherCollector,
+	},
+	{
+		name:           "homecoach",
+		defaultEnabled: false,
+		scopes:         []string{netatmo.ReadHomeCoach},
+		factory:        newHomeCoachCollector,
+	},
+}
+
+// Names returns the names of all metric groups which can be enabled with
+// WithCollectors.
+func Names() []string {
+	names := make([]string, 0, len(collectors))
+	for _, e := range collectors {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// DefaultEnabled reports whether the metric group with the given name is
+// enabled if WithCollectors is not used.
+func DefaultEnabled(name string) bool {
+	e := findCollector(name)
+	return e != nil && e.defaultEnabled
+}
+
+// DefaultCollectors returns the names of the metric groups enabled if
+// WithCollectors is not used.
+func DefaultCollectors() []string {
+	var names []string
+	for _, e := range collectors {
+		if e.defaultEnabled {
+			names = append(names, e.name)
+		}
+	}
+	return names
+}
+
+// Scopes returns the OAuth scopes the metric groups with the given names
+// need. Unknown names are ignored.
+func Scopes(names ...string) []string {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, name := range names {
+		e := findCollector(name)
+		if e == nil {
+			continue
+		}
+		for _, scope := range e.scopes {
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+func findCollector(name string) *collectorEntry {
+	for _, e := range collectors {
+		if e.name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// reauthenticator is implemented by clients which can lose their
+// authorization, like netatmo.Client.
+type reauthenticator interface {
+	NeedsReauth() bool
+}
+
+// scrape holds the data shared by all collectors during a single scrape,
+// so that e.g. the homes are only fetched once.
+type scrape struct {
+	client netatmo.API
+	now    time.Time
+
+	homesOnce sync.Once
+	homes     *netatmo.Homes
+	homesErr  error
+}
+
+// Homes returns the homes of the user, fetching them on first use.
+func (s *scrape) Homes() (*netatmo.Homes, error) {
+	s.homesOnce.Do(func() {
+		s.homes, s.homesErr = s.client.GetHomes()
+	})
+	return s.homes, s.homesErr
+}
+
+// homesFailed reports whether the homes were asked for, but the status of
+// none of them could be fetched. It must only be called once all
+// collectors are done.
+func (s *scrape) homesFailed() bool {
+	if s.homesErr != nil {
+		return true
+	}
+	return s.homes != nil && len(s.homes.Homes) == 0 && len(s.homes.Errors) > 0
+}
+
+// Collector is a prometheus.Collector running the enabled metric groups
+// on every scrape. It is safe for concurrent use: scrapes arriving while
+// another one is in flight wait for it and get its metrics instead of
+// fetching everything again.
+type Collector struct {
+	client         netatmo.API
+	options        *options
+	subsystems     map[string]subsystem
+	group          singleflight.Group
+	up             *prometheus.Desc
+	needsReauth    *prometheus.Desc
+	scrapeSuccess  *prometheus.Desc
+	scrapeDuration *prometheus.Desc
+
+	mu          sync.Mutex
+	cached      []prometheus.Metric
+	cachedAt    time.Time
+	failed      []string
+	homesFailed bool
+}
+
+// New creates a Collector fetching its data from client.
+func New(client netatmo.API, opts ...Option) (*Collector, error) {
+	o := &options{
+		namespace:  defaultNamespace,
+		collectors: DefaultCollectors(),
+		logger:     slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	subsystems := make(map[string]subsystem)
+	for _, name := range o.collectors {
+		e := findCollector(name)
+		if e == nil {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		subsystems[e.name] = e.factory(client, o)
+	}
+
+	return &Collector{
+		client:     client,
+		options:    o,
+		subsystems: subsystems,
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, "", "up"),
+			"Status of netatmo exporter, 1 if all collectors succeeded",
+			nil,
+			o.constLabels,
+		),
+
+		needsReauth: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, "", "needs_reauth"),
+			"Whether the token could not be refreshed, so the exporter has to be authorized again",
+			nil,
+			o.constLabels,
+		),
+
+		scrapeSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemScrape, "collector_success"),
+			"Whether a collector succeeded",
+			[]string{"collector"},
+			o.constLabels,
+		),
+
+		scrapeDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemScrape, "collector_duration_seconds"),
+			"Duration of a collector scrape",
+			[]string{"collector"},
+			o.constLabels,
+		),
+	}, nil
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.needsReauth
+	ch <- c.scrapeSuccess
+	ch <- c.scrapeDuration
+	for _, collector := range c.subsystems {
+		collector.Describe(ch)
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	v, _, _ := c.group.Do("scrape", func() (interface{}, error) {
+		c.mu.Lock()
+		if c.options.cacheTTL > 0 && time.Since(c.cachedAt) < c.options.cacheTTL {
+			defer c.mu.Unlock()
+			return c.cached, nil
+		}
+		c.mu.Unlock()
+
+		metrics := c.scrape()
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.cached = metrics
+		c.cachedAt = time.Now()
+		return metrics, nil
+	})
+
+	for _, m := range v.([]prometheus.Metric) {
+		ch <- m
+	}
+}
+
+// Enabled returns the names of the enabled metric groups.
+func (c *Collector) Enabled() []string {
+	names := make([]string, 0, len(c.subsystems))
+	for name := range c.subsystems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Failed returns the names of the metric groups which failed during the
+// last scrape.
+func (c *Collector) Failed() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.failed...)
+}
+
+// HomesFailed reports whether the last scrape could not fetch the status of
+// any energy home, so that none of their metrics are there.
+func (c *Collector) HomesFailed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.homesFailed
+}
+
+// scrape runs all collectors in parallel and returns their metrics.
+func (c *Collector) scrape() []prometheus.Metric {
+	s := &scrape{
+		client: c.client,
+		now:    time.Now(),
+	}
+
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var failed []string
+	wg.Add(len(c.subsystems))
+	for name, collector := range c.subsystems {
+		go func(name string, collector subsystem) {
+			defer wg.Done()
+			if !c.execute(name, collector, s, ch) {
+				mu.Lock()
+				failed = append(failed, name)
+				mu.Unlock()
+			}
+		}(name, collector)
+	}
+	wg.Wait()
+
+	sort.Strings(failed)
+	c.mu.Lock()
+	c.failed = failed
+	c.homesFailed = s.homesFailed()
+	c.mu.Unlock()
+
+	up := 1.0
+	if len(failed) > 0 {
+		up = 0
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up)
+	if r, ok := c.client.(reauthenticator); ok {
+		ch <- prometheus.MustNewConstMetric(c.needsReauth, prometheus.GaugeValue, boolToFloat(r.NeedsReauth()))
+	}
+	close(ch)
+
+	return <-done
+}
+
+func (c *Collector) execute(name string, collector subsystem, s *scrape, ch chan<- prometheus.Metric) bool {
+	begin := time.Now()
+	err := collector.Update(s, ch)
+	duration := time.Since(begin)
+
+	success := 1.0
+	if err != nil {
+		c.options.logger.Error("Collector failed", "collector", name, "duration", duration, "err", err)
+		success = 0
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.scrapeDuration, prometheus.GaugeValue, duration.Seconds(), name)
+	ch <- prometheus.MustNewConstMetric(c.scrapeSuccess, prometheus.GaugeValue, success, name)
+
+	return err == nil
+}
+
+// homeLabelValues returns the values of homeLabelNames.
+func homeLabelValues(id string, name string, country string, altitude uint32, coordinates []float64) []string {
+	lat, long := "", ""
+	if len(coordinates) == 2 {
+		lat = strconv.FormatFloat(coordinates[0], 'f', 8, 64)
+		long = strconv.FormatFloat(coordinates[1], 'f', 8, 64)
+	}
+
+	return []string{
+		id,
+		name,
+		country,
+		strconv.FormatUint(uint64(altitude), 10),
+		lat,
+		long,
+	}
+}
+
+func homeLabels(home *netatmo.Home) []string {
+	return homeLabelValues(home.Id, home.Name, home.Country, home.Altitude, home.Coordinates)
+}
+
+// placeHomeLabels returns the home labels of a device located at p.
+func placeHomeLabels(homeId string, homeName string, p *netatmo.Place) []string {
+	if p == nil {
+		return homeLabelValues(homeId, homeName, "", 0, nil)
+	}
+	return homeLabelValues(homeId, homeName, p.Country, p.Altitude, p.Location)
+}
+
+// sendOptional sends a gauge for v, unless the API did not report a value.
+func sendOptional(ch chan<- prometheus.Metric, desc *prometheus.Desc, v *float64, labels []string) {
+	if v == nil {
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		desc,
+		prometheus.GaugeValue,
+		*v,
+		labels...,
+	)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,242 @@
+package collector
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// countingAPI counts the calls of GetHomes and lets them block until
+// release is closed, so that scrapes are sure to overlap.
+type countingAPI struct {
+	netatmo.API
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newCountingAPI(api netatmo.API) *countingAPI {
+	return &countingAPI{
+		API:     api,
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}),
+	}
+}
+
+func (a *countingAPI) GetHomes() (*netatmo.Homes, error) {
+	a.calls.Add(1)
+	select {
+	case a.started <- struct{}{}:
+	default:
+	}
+	<-a.release
+	return a.API.GetHomes()
+}
+
+func testMemory() *netatmo.Memory {
+	temperature := 20.5
+	reachable := true
+
+	var m netatmo.Memory
+	m.SetHomesData(&netatmo.HomesData{Homes: []*netatmo.Home{{
+		Id:    "home-1",
+		Name:  "Home",
+		Rooms: []*netatmo.Room{{Id: "room-1", Name: "Living"}},
+	}}})
+	m.SetHomeStatus("home-1", &netatmo.HomeStatus{Home: &netatmo.Home{
+		Id:    "home-1",
+		Rooms: []*netatmo.Room{{Id: "room-1", Reachable: &reachable, MeasuredTemperature: &temperature}},
+	}})
+	return &m
+}
+
+// scrapeServer serves the metrics of c and counts the requests which have
+// reached the handler.
+func scrapeServer(t *testing.T, c *Collector) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	var entered atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered.Add(1)
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &entered
+}
+
+// scrapeConcurrently sends n requests to srv at once and returns the
+// response bodies. It may be called from other goroutines than the test's.
+func scrapeConcurrently(t *testing.T, srv *httptest.Server, n int) []string {
+	t.Helper()
+
+	bodies := make([]string, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer resp.Body.Close()
+			b, err := io.ReadAll(resp.Body)
+			bodies[i], errs[i] = string(b), err
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	return bodies
+}
+
+func TestCollectCoalescesConcurrentScrapes(t *testing.T) {
+	const scrapes = 20
+
+	api := newCountingAPI(testMemory())
+	c, err := New(api, WithCollectors("energy_homes", "energy_rooms", "energy_modules", "schedules"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, entered := scrapeServer(t, c)
+
+	// GetHomes blocks until all requests have reached the handler, so all
+	// of them arrive while the first scrape is in flight.
+	go func() {
+		<-api.started
+		for entered.Load() < scrapes {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(50 * time.Millisecond)
+		close(api.release)
+	}()
+
+	for i, body := range scrapeConcurrently(t, srv, scrapes) {
+		if !strings.Contains(body, "netatmo_up 1") {
+			t.Errorf("scrape %d did not succeed:\n%s", i, body)
+		}
+		if !strings.Contains(body, `room_id="room-1"} 20.5`) {
+			t.Errorf("scrape %d lacks the room temperature:\n%s", i, body)
+		}
+	}
+
+	if calls := api.calls.Load(); calls != 1 {
+		t.Errorf("GetHomes was called %d times for overlapping scrapes, want 1", calls)
+	}
+
+	// a scrape after the others finished fetches again
+	scrapeConcurrently(t, srv, 1)
+	if calls := api.calls.Load(); calls != 2 {
+		t.Errorf("GetHomes was called %d times after another scrape, want 2", calls)
+	}
+}
+
+func TestCollectConcurrentScrapes(t *testing.T) {
+	// Scrapes come and go while others are in flight. Run with -race to
+	// check the collectors for data races.
+	api := newCountingAPI(testMemory())
+	close(api.release)
+	c, err := New(api, WithCollectors(Names()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := scrapeServer(t, c)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				for _, body := range scrapeConcurrently(t, srv, 2) {
+					if !strings.Contains(body, "netatmo_scrape_collector_success") {
+						t.Errorf("scrape lacks the collector status:\n%s", body)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := api.calls.Load(); calls < 1 || calls > 100 {
+		t.Errorf("GetHomes was called %d times for 100 scrapes", calls)
+	}
+}
+
+func TestCollectCacheTTL(t *testing.T) {
+	api := newCountingAPI(testMemory())
+	close(api.release)
+	c, err := New(api, WithCollectors("energy_rooms"), WithCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, _ := scrapeServer(t, c)
+
+	for i := 0; i < 3; i++ {
+		scrapeConcurrently(t, srv, 5)
+	}
+
+	if calls := api.calls.Load(); calls != 1 {
+		t.Errorf("GetHomes was called %d times within the cache TTL, want 1", calls)
+	}
+}
+
+func TestCollectFailedHomes(t *testing.T) {
+	tests := []struct {
+		name            string
+		statuses        []string
+		wantFailed      []string
+		wantHomesFailed bool
+	}{
+		{"all homes", []string{"home-1", "home-2"}, nil, false},
+		{"one home missing", []string{"home-1"}, []string{"energy_homes"}, false},
+		{"all homes missing", nil, []string{"energy_homes"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m netatmo.Memory
+			m.SetHomesData(&netatmo.HomesData{Homes: []*netatmo.Home{{Id: "home-1"}, {Id: "home-2"}}})
+			for _, home := range tt.statuses {
+				m.SetHomeStatus(home, &netatmo.HomeStatus{Home: &netatmo.Home{Id: home}})
+			}
+
+			c, err := New(&m, WithCollectors("energy_homes", "energy_rooms", "energy_modules"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(c)
+			if _, err := registry.Gather(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := c.Failed(); !reflect.DeepEqual(got, tt.wantFailed) {
+				t.Errorf("Failed() = %v, want %v", got, tt.wantFailed)
+			}
+			if got := c.HomesFailed(); got != tt.wantHomesFailed {
+				t.Errorf("HomesFailed() = %v, want %v", got, tt.wantHomesFailed)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+// Package collector provides a prometheus.Collector exporting the homes,
+// rooms, modules, schedules and devices of a Netatmo account.
+//
+// The collector fetches its data through a netatmo.API, usually a
+// netatmo.Client, and is configured with options:
+//
+//	c, err := collector.New(client,
+//		collector.WithCollectors("energy_rooms", "weather"),
+//		collector.WithCacheTTL(time.Minute),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	prometheus.MustRegister(c)
+//
+// The exported API of this package follows the semantic versioning of the
+// module: it only changes incompatibly with a new major version.
+package collector
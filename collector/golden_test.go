@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/common/expfmt"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+var update = flag.Bool("update", false, "write the collected metrics to the golden files")
+
+// fixture holds the API bodies a netatmo.Memory is filled with, read from
+// testdata/<name>.json.
+type fixture struct {
+	HomesData    *netatmo.HomesData             `json:"homesdata"`
+	HomeStatus   map[string]*netatmo.HomeStatus `json:"homestatus"`
+	StationsData *netatmo.StationsData          `json:"stationsdata"`
+}
+
+func loadFixture(t *testing.T, name string) *netatmo.Memory {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var f fixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatalf("could not decode %s: %v", name, err)
+	}
+
+	m := &netatmo.Memory{}
+	if f.HomesData != nil {
+		m.SetHomesData(f.HomesData)
+	}
+	for home, status := range f.HomeStatus {
+		m.SetHomeStatus(home, status)
+	}
+	if f.StationsData != nil {
+		m.SetStationsData(f.StationsData)
+	}
+	return m
+}
+
+// goldenMetricNames returns the names of the metric families in a golden
+// file, so that only those are compared.
+func goldenMetricNames(t *testing.T, golden []byte) []string {
+	t.Helper()
+
+	var names []string
+	s := bufio.NewScanner(bytes.NewReader(golden))
+	for s.Scan() {
+		if fields := strings.Fields(s.Text()); len(fields) >= 3 && fields[0] == "#" && fields[1] == "TYPE" {
+			names = append(names, fields[2])
+		}
+	}
+	if len(names) == 0 {
+		t.Fatal("golden file has no metrics")
+	}
+	return names
+}
+
+// writeGolden writes the metrics of c to path, without the scrape
+// durations, which differ every time.
+func writeGolden(t *testing.T, c prometheus.Collector, path string) {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	for _, mf := range families {
+		if strings.HasSuffix(mf.GetName(), "_duration_seconds") {
+			continue
+		}
+		if _, err := expfmt.MetricFamilyToText(&buf, mf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollectGolden(t *testing.T) {
+	tests := []struct {
+		name       string
+		collectors []string
+	}{
+		// a relay bridging a thermostat and a valve, the relay does not
+		// report reachable
+		{"thermostat_valves", []string{"energy_homes", "energy_rooms", "energy_modules"}},
+		// an unreachable room and valve with a module error, and a home
+		// without status
+		{"unreachable", []string{"energy_homes", "energy_rooms", "energy_modules"}},
+		// an indoor station with outdoor and rain modules and an
+		// unreachable wind module
+		{"weather_station", []string{"weather"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// counters like status_errors_total change with every scrape,
+			// so every scrape gets a new collector
+			newCollector := func() *Collector {
+				c, err := New(loadFixture(t, tt.name), WithCollectors(tt.collectors...))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return c
+			}
+
+			path := filepath.Join("testdata", tt.name+".prom")
+			if *update {
+				writeGolden(t, newCollector(), path)
+			}
+
+			golden, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := testutil.CollectAndCompare(newCollector(), bytes.NewReader(golden), goldenMetricNames(t, golden)...); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
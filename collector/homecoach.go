@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+const subsystemHomeCoach = "homecoach"
+
+// homeCoachCollector exports the measurements of Healthy Home Coach devices.
+type homeCoachCollector struct {
+	client       netatmo.API
+	reachable    *prometheus.Desc
+	temperature  *prometheus.Desc
+	humidity     *prometheus.Desc
+	co2          *prometheus.Desc
+	noise        *prometheus.Desc
+	pressure     *prometheus.Desc
+	healthIndex  *prometheus.Desc
+	wifiStrength *prometheus.Desc
+}
+
+func newHomeCoachCollector(client netatmo.API, o *options) subsystem {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemHomeCoach, name),
+			help,
+			deviceLabelNames,
+			o.constLabels,
+		)
+	}
+
+	return &homeCoachCollector{
+		client: client,
+
+		reachable:    desc("reachable", "Tells if the device is currently reachable"),
+		temperature:  desc("temperature", "Measured temperature in °C"),
+		humidity:     desc("humidity", "Measured relative humidity in %"),
+		co2:          desc("co2", "Measured CO2 concentration in ppm"),
+		noise:        desc("noise", "Measured noise level in dB"),
+		pressure:     desc("pressure", "Measured sea level pressure in mbar"),
+		healthIndex:  desc("health_index", "Health index from 0 (healthy) to 4 (unhealthy)"),
+		wifiStrength: desc("wifi_strength", "WiFi signal strength of the device"),
+	}
+}
+
+func (c *homeCoachCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reachable
+	ch <- c.temperature
+	ch <- c.humidity
+	ch <- c.co2
+	ch <- c.noise
+	ch <- c.pressure
+	ch <- c.healthIndex
+	ch <- c.wifiStrength
+}
+
+func (c *homeCoachCollector) Update(_ *scrape, ch chan<- prometheus.Metric) error {
+	coachs, err := c.client.GetHomeCoachsData()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range coachs.Devices {
+		labels := append(
+			placeHomeLabels(d.HomeId, d.HomeName, d.Place),
+			"",
+			d.Id,
+			d.Type,
+		)
+
+		if d.Reachable != nil {
+			ch <- prometheus.MustNewConstMetric(
+				c.reachable,
+				prometheus.GaugeValue,
+				boolToFloat(*d.Reachable),
+				labels...,
+			)
+		}
+
+		if !d.IsReachable() {
+			continue
+		}
+
+		sendOptional(ch, c.wifiStrength, d.WifiStatus, labels)
+
+		if dd := d.DashboardData; dd != nil {
+			sendOptional(ch, c.temperature, dd.Temperature, labels)
+			sendOptional(ch, c.humidity, dd.Humidity, labels)
+			sendOptional(ch, c.co2, dd.CO2, labels)
+			sendOptional(ch, c.noise, dd.Noise, labels)
+			sendOptional(ch, c.pressure, dd.Pressure, labels)
+			sendOptional(ch, c.healthIndex, dd.HealthIdx, labels)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// homesCollector exports whether the status of each energy home could be
+// fetched, so a single failing home is visible. It fails if any home did
+// not get its status, as the metrics of that home are missing.
+type homesCollector struct {
+	up           *prometheus.Desc
+	statusErrors *prometheus.Desc
+
+	mu     sync.Mutex
+	errors map[string]float64
+}
+
+func newHomesCollector(_ netatmo.API, o *options) subsystem {
+	return &homesCollector{
+		errors: make(map[string]float64),
+
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemHome, "up"),
+			"Whether the status of a home could be fetched",
+			homeLabelNames,
+			o.constLabels,
+		),
+
+		statusErrors: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemHome, "status_errors_total"),
+			"Number of times the status of a home could not be fetched",
+			homeLabelNames,
+			o.constLabels,
+		),
+	}
+}
+
+func (c *homesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- c.statusErrors
+}
+
+func (c *homesCollector) Update(s *scrape, ch chan<- prometheus.Metric) error {
+	homes, err := s.Homes()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, home := range homes.Homes {
+		c.send(ch, home, 1)
+	}
+
+	for _, e := range homes.Errors {
+		c.errors[e.Home.Id]++
+		c.send(ch, e.Home, 0)
+	}
+
+	if len(homes.Errors) > 0 {
+		return fmt.Errorf("could not get the status of %d of %d homes", len(homes.Errors), len(homes.Errors)+len(homes.Homes))
+	}
+	return nil
+}
+
+func (c *homesCollector) send(ch chan<- prometheus.Metric, home *netatmo.Home, up float64) {
+	labelsHome := homeLabels(home)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.up,
+		prometheus.GaugeValue,
+		up,
+		labelsHome...,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.statusErrors,
+		prometheus.CounterValue,
+		c.errors[home.Id],
+		labelsHome...,
+	)
+}
@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"sync"
+	"time"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+const measureStep = 5 * time.Minute
+
+// measureHistory sums up measures of modules fetched with getmeasure since
+// the exporter started, so they can be exported as counters.
+type measureHistory struct {
+	client  netatmo.API
+	types   []string
+	mu      sync.Mutex
+	modules map[string]*moduleHistory
+}
+
+type moduleHistory struct {
+	last time.Time
+	sums map[string]float64
+}
+
+func newMeasureHistory(client netatmo.API, types ...string) *measureHistory {
+	return &measureHistory{
+		client:  client,
+		types:   types,
+		modules: make(map[string]*moduleHistory),
+	}
+}
+
+// update adds the measures of m since its last update to the history and
+// returns the sums per measure type. Only complete measure intervals are
+// added, so nothing is counted twice. The first update of a module starts
+// an hour ago.
+func (h *measureHistory) update(m *netatmo.Module, now time.Time) (map[string]float64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	mh, ok := h.modules[m.Id]
+	if !ok {
+		mh = &moduleHistory{
+			last: now.Add(-time.Hour),
+			sums: make(map[string]float64),
+		}
+		h.modules[m.Id] = mh
+	}
+
+	measures, err := h.client.GetMeasure(m, h.types, mh.last.Add(time.Second), now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range measures.Measures {
+		t := time.Unix(p.Time, 0)
+		if !t.After(mh.last) || t.Add(measureStep).After(now) {
+			continue
+		}
+		for k, v := range p.Values {
+			mh.sums[k] += v
+		}
+		mh.last = t
+	}
+
+	sums := make(map[string]float64, len(h.types))
+	for _, t := range h.types {
+		sums[t] = mh.sums[t]
+	}
+	return sums, nil
+}
@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// energyMeterTypes are the Legrand/BTicino Home+Control modules which meter
+// their electricity consumption.
+var energyMeterTypes = map[string]bool{
+	"NLPC": true,
+	"NLP":  true,
+	"NLPM": true,
+	"NLPO": true,
+}
+
+// meterCollector exports the power and energy consumption of Legrand
+// Home+Control devices.
+type meterCollector struct {
+	history *measureHistory
+	power   *prometheus.Desc
+	energy  *prometheus.Desc
+}
+
+func newMeterCollector(client netatmo.API, o *options) subsystem {
+	return &meterCollector{
+		history: newMeasureHistory(client, netatmo.MeasureSumEnergyElec),
+
+		power: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "power_watts"),
+			"Instantaneous power consumption of a device",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		energy: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "energy_watt_hours_total"),
+			"Energy consumed by a device",
+			moduleLabelNames,
+			o.constLabels,
+		),
+	}
+}
+
+func (c *meterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.power
+	ch <- c.energy
+}
+
+func (c *meterCollector) Update(s *scrape, ch chan<- prometheus.Metric) error {
+	homes, err := s.Homes()
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, home := range homes.Homes {
+		labelsHome := homeLabels(home)
+
+		for _, m := range home.Modules {
+			labelsModule := append(
+				labelsHome,
+				m.RoomId,
+				m.Bridge,
+				m.Id,
+				m.Type,
+			)
+
+			if !m.IsUnreachable() {
+				sendOptional(ch, c.power, m.Power, labelsModule)
+			}
+
+			if !energyMeterTypes[m.Type] || m.Bridge == "" {
+				continue
+			}
+
+			sums, err := c.history.update(m, s.now)
+			if err != nil {
+				lastErr = fmt.Errorf("module %s: %w", m.Id, err)
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(
+				c.energy,
+				prometheus.CounterValue,
+				sums[netatmo.MeasureSumEnergyElec],
+				labelsModule...,
+			)
+		}
+	}
+
+	return lastErr
+}
@@ -0,0 +1,152 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// modulesCollector exports the modules of energy homes, like thermostats,
+// valves and relays.
+type modulesCollector struct {
+	fwRevision   *prometheus.Desc
+	boilerStatus *prometheus.Desc
+	reachable    *prometheus.Desc
+	wifiStrength *prometheus.Desc
+	rfStrength   *prometheus.Desc
+	batteryLevel *prometheus.Desc
+	moduleError  *prometheus.Desc
+}
+
+func newModulesCollector(_ netatmo.API, o *options) subsystem {
+	moduleErrorLabelNames := append(
+		homeLabelNames,
+		"module_id",
+		"code",
+		"description",
+	)
+
+	return &modulesCollector{
+		fwRevision: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "firmware_revision"),
+			"Firmware revision of module",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		boilerStatus: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "boiler_status"),
+			"Status of the boiler",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		wifiStrength: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "wifi_strength"),
+			"WiFi signal strength",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		rfStrength: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "rf_strength"),
+			"Radio signal strength",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		batteryLevel: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "battery_level"),
+			"Level of the battery",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		reachable: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "reachable"),
+			"Tells if the module is currently reachable",
+			moduleLabelNames,
+			o.constLabels,
+		),
+
+		moduleError: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemModule, "error"),
+			"Error homestatus currently reports for a module",
+			moduleErrorLabelNames,
+			o.constLabels,
+		),
+	}
+}
+
+func (c *modulesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.fwRevision
+	ch <- c.boilerStatus
+	ch <- c.reachable
+	ch <- c.wifiStrength
+	ch <- c.rfStrength
+	ch <- c.batteryLevel
+	ch <- c.moduleError
+}
+
+func (c *modulesCollector) Update(s *scrape, ch chan<- prometheus.Metric) error {
+	homes, err := s.Homes()
+	if err != nil {
+		return err
+	}
+
+	for _, home := range homes.Homes {
+		labelsHome := homeLabels(home)
+
+		for _, m := range home.Modules {
+			labelsModule := append(
+				labelsHome,
+				m.RoomId,
+				m.Bridge,
+				m.Id,
+				m.Type,
+			)
+
+			if m.Reachable != nil {
+				ch <- prometheus.MustNewConstMetric(
+					c.reachable,
+					prometheus.GaugeValue,
+					boolToFloat(*m.Reachable),
+					labelsModule...,
+				)
+			}
+
+			// An unreachable module does not report fresh values, so
+			// nothing is exported rather than stale data or zeros. Values
+			// of modules without reachable, like relays, are kept.
+			if m.IsUnreachable() {
+				continue
+			}
+
+			sendOptional(ch, c.batteryLevel, m.BatteryLevel, labelsModule)
+			sendOptional(ch, c.wifiStrength, m.WifiStrength, labelsModule)
+			sendOptional(ch, c.rfStrength, m.RfStrength, labelsModule)
+			sendOptional(ch, c.fwRevision, m.FirmwareRevision, labelsModule)
+
+			if m.BoilerStatus != nil {
+				ch <- prometheus.MustNewConstMetric(
+					c.boilerStatus,
+					prometheus.GaugeValue,
+					boolToFloat(*m.BoilerStatus),
+					labelsModule...,
+				)
+			}
+		}
+
+		for _, e := range home.ModuleErrors {
+			ch <- prometheus.MustNewConstMetric(
+				c.moduleError,
+				prometheus.GaugeValue,
+				1,
+				append(labelsHome, e.Id, strconv.Itoa(e.Code), e.Description())...,
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package collector
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Option configures a Collector.
+type Option func(*options)
+
+type options struct {
+	namespace   string
+	constLabels prometheus.Labels
+	collectors  []string
+	cacheTTL    time.Duration
+	logger      *slog.Logger
+}
+
+// WithNamespace sets the prefix of all metric names, netatmo by default.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithConstLabels adds labels with fixed values to all metrics, e.g. to
+// tell several accounts apart.
+func WithConstLabels(labels prometheus.Labels) Option {
+	return func(o *options) {
+		o.constLabels = labels
+	}
+}
+
+// WithCollectors enables exactly the metric groups with the given names,
+// see Names. DefaultCollectors are enabled if it is not used.
+func WithCollectors(names ...string) Option {
+	return func(o *options) {
+		o.collectors = names
+	}
+}
+
+// WithCacheTTL lets scrapes within ttl of the last one return its metrics
+// instead of fetching them again. Nothing is cached by default.
+func WithCacheTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.cacheTTL = ttl
+	}
+}
+
+// WithLogger sets the logger for failing metric groups, slog.Default() by
+// default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
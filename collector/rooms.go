@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// roomsCollector exports the rooms of energy homes.
+type roomsCollector struct {
+	reachable     *prometheus.Desc
+	temperature   *prometheus.Desc
+	spTemperature *prometheus.Desc
+	openWindow    *prometheus.Desc
+}
+
+func newRoomsCollector(_ netatmo.API, o *options) subsystem {
+	return &roomsCollector{
+		reachable: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemRoom, "reachable"),
+			"Tells if the room is currently reachable",
+			roomLabelNames,
+			o.constLabels,
+		),
+
+		openWindow: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemRoom, "open_window"),
+			"Tells if the window is open.",
+			roomLabelNames,
+			o.constLabels,
+		),
+
+		temperature: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemRoom, "temperature"),
+			"Measured Temperature in a room",
+			roomLabelNames,
+			o.constLabels,
+		),
+
+		spTemperature: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemRoom, "sp_temperature"),
+			"Set Point Temperature of a room",
+			roomLabelNames,
+			o.constLabels,
+		),
+	}
+}
+
+func (c *roomsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reachable
+	ch <- c.temperature
+	ch <- c.spTemperature
+	ch <- c.openWindow
+}
+
+func (c *roomsCollector) Update(s *scrape, ch chan<- prometheus.Metric) error {
+	homes, err := s.Homes()
+	if err != nil {
+		return err
+	}
+
+	for _, home := range homes.Homes {
+		labelsHome := homeLabels(home)
+
+		for _, room := range home.Rooms {
+			labelsRoom := append(labelsHome, room.Id)
+
+			if room.Reachable != nil {
+				ch <- prometheus.MustNewConstMetric(
+					c.reachable,
+					prometheus.GaugeValue,
+					boolToFloat(*room.Reachable),
+					labelsRoom...,
+				)
+			}
+
+			if room.IsUnreachable() {
+				continue
+			}
+
+			sendOptional(ch, c.temperature, room.MeasuredTemperature, labelsRoom)
+			sendOptional(ch, c.spTemperature, room.SetPointTemperature, labelsRoom)
+
+			if room.OpenWindow != nil {
+				ch <- prometheus.MustNewConstMetric(
+					c.openWindow,
+					prometheus.GaugeValue,
+					boolToFloat(*room.OpenWindow),
+					labelsRoom...,
+				)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// scheduleCollector exports the state of the active heating schedule of
+// energy homes.
+type scheduleCollector struct {
+	scheduleZone       *prometheus.Desc
+	zoneTemperature    *prometheus.Desc
+	scheduledSetPoint  *prometheus.Desc
+	nextScheduleChange *prometheus.Desc
+}
+
+func newScheduleCollector(_ netatmo.API, o *options) subsystem {
+	scheduleLabelNames := append(
+		homeLabelNames,
+		"schedule_id",
+		"schedule_name",
+		"zone_id",
+		"zone_name",
+	)
+
+	return &scheduleCollector{
+		scheduleZone: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemHome, "schedule_zone"),
+			"Zone the active schedule of a home is currently in",
+			scheduleLabelNames,
+			o.constLabels,
+		),
+
+		zoneTemperature: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemRoom, "schedule_zone_temperature"),
+			"Target temperature of a room in the current zone of the active schedule",
+			roomLabelNames,
+			o.constLabels,
+		),
+
+		scheduledSetPoint: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemRoom, "scheduled_setpoint_celsius"),
+			"Set point temperature of a room according to the therm mode and active schedule of its home",
+			roomLabelNames,
+			o.constLabels,
+		),
+
+		nextScheduleChange: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemHome, "next_schedule_change_timestamp_seconds"),
+			"Time of the next zone change of the active schedule of a home",
+			homeLabelNames,
+			o.constLabels,
+		),
+	}
+}
+
+func (c *scheduleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.scheduleZone
+	ch <- c.zoneTemperature
+	ch <- c.scheduledSetPoint
+	ch <- c.nextScheduleChange
+}
+
+func (c *scheduleCollector) Update(s *scrape, ch chan<- prometheus.Metric) error {
+	homes, err := s.Homes()
+	if err != nil {
+		return err
+	}
+
+	for _, home := range homes.Homes {
+		c.collectSchedule(ch, home, homeLabels(home), s)
+	}
+
+	return nil
+}
+
+func (c *scheduleCollector) collectSchedule(ch chan<- prometheus.Metric, home *netatmo.Home, labelsHome []string, s *scrape) {
+	schedule := home.ActiveSchedule()
+	if schedule == nil {
+		return
+	}
+
+	for _, room := range home.Rooms {
+		if setPoint, ok := home.ScheduledSetPoint(room.Id, s.now); ok {
+			ch <- prometheus.MustNewConstMetric(
+				c.scheduledSetPoint,
+				prometheus.GaugeValue,
+				setPoint,
+				append(labelsHome, room.Id)...,
+			)
+		}
+	}
+
+	local := s.now.In(home.Location())
+	if next, _, ok := schedule.NextChange(local); ok {
+		ch <- prometheus.MustNewConstMetric(
+			c.nextScheduleChange,
+			prometheus.GaugeValue,
+			float64(next.Unix()),
+			labelsHome...,
+		)
+	}
+
+	zone := schedule.ZoneAt(local)
+	if zone == nil {
+		return
+	}
+
+	labelsSchedule := append(
+		labelsHome,
+		schedule.Id,
+		schedule.Name,
+		strconv.Itoa(zone.Id),
+		zone.Name,
+	)
+
+	ch <- prometheus.MustNewConstMetric(
+		c.scheduleZone,
+		prometheus.GaugeValue,
+		1,
+		labelsSchedule...,
+	)
+
+	for _, room := range home.Rooms {
+		temperature, ok := zone.RoomTemperature(room.Id)
+		if !ok {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(
+			c.zoneTemperature,
+			prometheus.GaugeValue,
+			temperature,
+			append(labelsHome, room.Id)...,
+		)
+	}
+}
@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+const subsystemWeather = "weather"
+
+// weatherCollector exports the measurements of weather stations.
+type weatherCollector struct {
+	client           netatmo.API
+	reachable        *prometheus.Desc
+	temperature      *prometheus.Desc
+	humidity         *prometheus.Desc
+	co2              *prometheus.Desc
+	noise            *prometheus.Desc
+	pressure         *prometheus.Desc
+	absolutePressure *prometheus.Desc
+	rain             *prometheus.Desc
+	rain1h           *prometheus.Desc
+	rain24h          *prometheus.Desc
+	windStrength     *prometheus.Desc
+	windAngle        *prometheus.Desc
+	gustStrength     *prometheus.Desc
+	gustAngle        *prometheus.Desc
+	fwRevision       *prometheus.Desc
+	wifiStrength     *prometheus.Desc
+	rfStrength       *prometheus.Desc
+	batteryLevel     *prometheus.Desc
+}
+
+func newWeatherCollector(client netatmo.API, o *options) subsystem {
+	desc := func(name string, help string) *prometheus.Desc {
+		return prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, subsystemWeather, name),
+			help,
+			deviceLabelNames,
+			o.constLabels,
+		)
+	}
+
+	return &weatherCollector{
+		client: client,
+
+		reachable:        desc("reachable", "Tells if the station or module is currently reachable"),
+		temperature:      desc("temperature", "Measured temperature in °C"),
+		humidity:         desc("humidity", "Measured relative humidity in %"),
+		co2:              desc("co2", "Measured CO2 concentration in ppm"),
+		noise:            desc("noise", "Measured noise level in dB"),
+		pressure:         desc("pressure", "Measured sea level pressure in mbar"),
+		absolutePressure: desc("absolute_pressure", "Measured absolute pressure in mbar"),
+		rain:             desc("rain", "Rain in the last measurement interval in mm"),
+		rain1h:           desc("rain_1h", "Rain in the last hour in mm"),
+		rain24h:          desc("rain_24h", "Rain since midnight in mm"),
+		windStrength:     desc("wind_strength", "Wind strength in km/h"),
+		windAngle:        desc("wind_angle", "Wind angle in degrees"),
+		gustStrength:     desc("gust_strength", "Gust strength in km/h"),
+		gustAngle:        desc("gust_angle", "Gust angle in degrees"),
+		fwRevision:       desc("firmware_revision", "Firmware revision of the station or module"),
+		wifiStrength:     desc("wifi_strength", "WiFi signal strength of the station"),
+		rfStrength:       desc("rf_strength", "Radio signal strength of the module"),
+		batteryLevel:     desc("battery_level", "Battery level of the module in %"),
+	}
+}
+
+func (c *weatherCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.reachable
+	ch <- c.temperature
+	ch <- c.humidity
+	ch <- c.co2
+	ch <- c.noise
+	ch <- c.pressure
+	ch <- c.absolutePressure
+	ch <- c.rain
+	ch <- c.rain1h
+	ch <- c.rain24h
+	ch <- c.windStrength
+	ch <- c.windAngle
+	ch <- c.gustStrength
+	ch <- c.gustAngle
+	ch <- c.fwRevision
+	ch <- c.wifiStrength
+	ch <- c.rfStrength
+	ch <- c.batteryLevel
+}
+
+func (c *weatherCollector) Update(_ *scrape, ch chan<- prometheus.Metric) error {
+	stations, err := c.client.GetStationsData()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range stations.Devices {
+		labelsHome := placeHomeLabels(s.HomeId, s.HomeName, s.Place)
+
+		labelsStation := append(
+			labelsHome,
+			"",
+			s.Id,
+			s.Type,
+		)
+
+		if s.Reachable != nil {
+			ch <- prometheus.MustNewConstMetric(
+				c.reachable,
+				prometheus.GaugeValue,
+				boolToFloat(*s.Reachable),
+				labelsStation...,
+			)
+		}
+
+		if s.IsReachable() {
+			sendOptional(ch, c.fwRevision, s.Firmware, labelsStation)
+			sendOptional(ch, c.wifiStrength, s.WifiStatus, labelsStation)
+			c.collectDashboard(ch, s.DashboardData, labelsStation)
+		}
+
+		for _, m := range s.Modules {
+			labelsModule := append(
+				labelsHome,
+				s.Id,
+				m.Id,
+				m.Type,
+			)
+
+			if m.Reachable != nil {
+				ch <- prometheus.MustNewConstMetric(
+					c.reachable,
+					prometheus.GaugeValue,
+					boolToFloat(*m.Reachable),
+					labelsModule...,
+				)
+			}
+
+			if !m.IsReachable() {
+				continue
+			}
+
+			sendOptional(ch, c.fwRevision, m.Firmware, labelsModule)
+			sendOptional(ch, c.rfStrength, m.RfStatus, labelsModule)
+			sendOptional(ch, c.batteryLevel, m.BatteryPercent, labelsModule)
+			c.collectDashboard(ch, m.DashboardData, labelsModule)
+		}
+	}
+
+	return nil
+}
+
+func (c *weatherCollector) collectDashboard(ch chan<- prometheus.Metric, d *netatmo.DashboardData, labels []string) {
+	if d == nil {
+		return
+	}
+
+	sendOptional(ch, c.temperature, d.Temperature, labels)
+	sendOptional(ch, c.humidity, d.Humidity, labels)
+	sendOptional(ch, c.co2, d.CO2, labels)
+	sendOptional(ch, c.noise, d.Noise, labels)
+	sendOptional(ch, c.pressure, d.Pressure, labels)
+	sendOptional(ch, c.absolutePressure, d.AbsolutePressure, labels)
+	sendOptional(ch, c.rain, d.Rain, labels)
+	sendOptional(ch, c.rain1h, d.SumRain1, labels)
+	sendOptional(ch, c.rain24h, d.SumRain24, labels)
+	sendOptional(ch, c.windStrength, d.WindStrength, labels)
+	sendOptional(ch, c.windAngle, d.WindAngle, labels)
+	sendOptional(ch, c.gustStrength, d.GustStrength, labels)
+	sendOptional(ch, c.gustAngle, d.GustAngle, labels)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"time"
+
+	"github.com/tipok/netatmo_exporter/collector"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// collectorFlags configure which metrics the exporter collects.
+type collectorFlags struct {
+	enabled  map[string]*bool
+	cacheTTL time.Duration
+}
+
+func (f *collectorFlags) register(fs *flag.FlagSet) {
+	f.enabled = make(map[string]*bool)
+	for _, name := range collector.Names() {
+		f.enabled[name] = fs.Bool(
+			"collector."+name,
+			collector.DefaultEnabled(name),
+			"Enable the "+name+" collector",
+		)
+	}
+	fs.DurationVar(&f.cacheTTL, "cache-ttl", 0, "Serve scrapes within this duration of the previous one from its result")
+}
+
+// collectors returns the names of the enabled collectors.
+func (f *collectorFlags) collectors() []string {
+	var names []string
+	for _, name := range collector.Names() {
+		if *f.enabled[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newCollector creates the collector fetching its data from client.
+func (f *collectorFlags) newCollector(client netatmo.API) (*collector.Collector, error) {
+	return collector.New(
+		client,
+		collector.WithCollectors(f.collectors()...),
+		collector.WithCacheTTL(f.cacheTTL),
+	)
+}
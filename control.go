@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+const setUsage = `Usage: netatmo_exporter set <command> [flags]
+
+Commands:
+  room <name|id> <temperature> [--for 2h]   heat a room to a temperature
+  mode away|hg|schedule [--until ...]       set the mode of a home
+`
+
+const resetUsage = `Usage: netatmo_exporter reset <command> [flags]
+
+Commands:
+  room <name|id>   let a room follow the mode of its home again
+`
+
+// confirmAttempts and confirmInterval limit how long a change is waited for
+// to show up in homestatus.
+const (
+	confirmAttempts = 5
+	confirmInterval = 2 * time.Second
+)
+
+func runSet(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, setUsage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "room":
+		err = setRoom(args[1:])
+	case "mode":
+		err = setMode(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, setUsage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func runReset(args []string) {
+	if len(args) == 0 || args[0] != "room" {
+		fmt.Fprint(os.Stderr, resetUsage)
+		os.Exit(2)
+	}
+
+	if err := resetRoom(args[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+// controlFlags are the flags of all commands changing a home.
+type controlFlags struct {
+	clientFlags
+	home string
+}
+
+func (f *controlFlags) register(fs *flag.FlagSet) {
+	f.clientFlags.register(fs)
+	fs.StringVar(&f.home, "home", "", "Id or name of the home, only needed if the account has several")
+}
+
+// homeClient creates a client allowed to change homes and returns the home
+// selected by the flags.
+func (f *controlFlags) homeClient() (*netatmo.Client, *netatmo.Home, error) {
+	client, err := f.newClient(context.Background(), netatmo.ReadThermostat, netatmo.WriteThermostat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	homesData, err := client.GetHomesData()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h, err := selectHome(homesData, f.home)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, h, nil
+}
+
+func setRoom(args []string) error {
+	fs := flag.NewFlagSet("set room", flag.ExitOnError)
+	var cf controlFlags
+	var duration time.Duration
+	cf.register(fs)
+	fs.DurationVar(&duration, "for", 0, "How long to keep the temperature, the default duration of the home if not set")
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 2 {
+		return errors.New("usage: set room <name|id> <temperature> [--for 2h]")
+	}
+
+	temp, err := strconv.ParseFloat(pos[1], 64)
+	if err != nil {
+		return fmt.Errorf("invalid temperature %q", pos[1])
+	}
+
+	client, h, err := cf.homeClient()
+	if err != nil {
+		return err
+	}
+
+	room, err := selectRoom(h, pos[0])
+	if err != nil {
+		return err
+	}
+
+	var until time.Time
+	if duration > 0 {
+		until = time.Now().Add(duration)
+	}
+	if err := client.SetRoomThermPoint(h.Id, room.Id, netatmo.SetPointModeManual, &temp, until); err != nil {
+		return err
+	}
+
+	return confirmRooms(client, h, func(r *netatmo.Room) error {
+		if r.Id != room.Id {
+			return nil
+		}
+		if r.SetPointMode == nil || *r.SetPointMode != netatmo.SetPointModeManual ||
+			r.SetPointTemperature == nil || *r.SetPointTemperature != temp {
+			return fmt.Errorf("room %s is not heated to %v yet", room.Name, temp)
+		}
+		return nil
+	}, fmt.Sprintf("Room %s is heated to %v", room.Name, temp))
+}
+
+func resetRoom(args []string) error {
+	fs := flag.NewFlagSet("reset room", flag.ExitOnError)
+	var cf controlFlags
+	cf.register(fs)
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 1 {
+		return errors.New("usage: reset room <name|id>")
+	}
+
+	client, h, err := cf.homeClient()
+	if err != nil {
+		return err
+	}
+
+	room, err := selectRoom(h, pos[0])
+	if err != nil {
+		return err
+	}
+
+	if err := client.SetRoomThermPoint(h.Id, room.Id, netatmo.SetPointModeHome, nil, time.Time{}); err != nil {
+		return err
+	}
+
+	return confirmRooms(client, h, func(r *netatmo.Room) error {
+		if r.Id != room.Id {
+			return nil
+		}
+		if r.SetPointMode != nil && (*r.SetPointMode == netatmo.SetPointModeManual || *r.SetPointMode == netatmo.SetPointModeMax) {
+			return fmt.Errorf("room %s is still in %s mode", room.Name, *r.SetPointMode)
+		}
+		return nil
+	}, fmt.Sprintf("Room %s follows the home again", room.Name))
+}
+
+func setMode(args []string) error {
+	fs := flag.NewFlagSet("set mode", flag.ExitOnError)
+	var cf controlFlags
+	var until string
+	cf.register(fs)
+	fs.StringVar(&until, "until", "", "End of away or frost guard mode, a duration like 3d4h or a local time like 2006-01-02T15:04")
+	pos := parseInterspersed(fs, args)
+	if len(pos) != 1 {
+		return errors.New("usage: set mode away|hg|schedule [--until ...]")
+	}
+
+	mode := pos[0]
+	switch mode {
+	case netatmo.ThermModeAway, netatmo.ThermModeFrostGuard:
+	case netatmo.ThermModeSchedule:
+		if until != "" {
+			return errors.New("--until can only be used with away and hg")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, has to be away, hg or schedule", mode)
+	}
+
+	client, h, err := cf.homeClient()
+	if err != nil {
+		return err
+	}
+
+	var end time.Time
+	if until != "" {
+		if end, err = parseUntil(until, time.Now(), h.Location()); err != nil {
+			return err
+		}
+	}
+
+	if err := client.SetThermMode(h.Id, mode, end); err != nil {
+		return err
+	}
+
+	return confirmRooms(client, h, func(r *netatmo.Room) error {
+		if !r.IsReachable() || r.SetPointMode == nil {
+			return nil
+		}
+		if *r.SetPointMode != mode {
+			return fmt.Errorf("room %s is in %s mode instead of %s", r.Name, *r.SetPointMode, mode)
+		}
+		return nil
+	}, fmt.Sprintf("Home %s is in %s mode", h.Name, mode))
+}
+
+// confirmRooms re-reads the status of the home until check succeeds for
+// all rooms, and prints done then. Netatmo may take a moment to apply a
+// change, so the status is read a few times before giving up.
+func confirmRooms(client *netatmo.Client, h *netatmo.Home, check func(r *netatmo.Room) error, done string) error {
+	var err error
+	for attempt := 0; attempt < confirmAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(confirmInterval)
+		}
+
+		var status *netatmo.HomeStatus
+		if status, err = client.GetHomeStatus(h.Id); err != nil {
+			continue
+		}
+		if status.Home == nil {
+			err = errors.New("homestatus did not report the home")
+			continue
+		}
+
+		names := roomNames(h)
+		err = nil
+		for _, r := range status.Home.Rooms {
+			if r.Name == "" {
+				r.Name = names[r.Id]
+			}
+			if err = check(r); err != nil {
+				break
+			}
+		}
+		if err == nil {
+			fmt.Println(done)
+			return nil
+		}
+	}
+	return fmt.Errorf("change was sent, but could not be confirmed: %w", err)
+}
+
+// selectHome returns the home with the given id or name, or the only home
+// of the account if name is empty.
+func selectHome(homesData *netatmo.HomesData, name string) (*netatmo.Home, error) {
+	if name == "" {
+		if len(homesData.Homes) != 1 {
+			return nil, fmt.Errorf("account has %d homes, select one with --home", len(homesData.Homes))
+		}
+		return homesData.Homes[0], nil
+	}
+
+	for _, h := range homesData.Homes {
+		if h.Id == name || strings.EqualFold(h.Name, name) {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("no home %q", name)
+}
+
+// selectRoom returns the room of h with the given id or name.
+func selectRoom(h *netatmo.Home, name string) (*netatmo.Room, error) {
+	var found *netatmo.Room
+	for _, r := range h.Rooms {
+		if r.Id == name {
+			return r, nil
+		}
+		if strings.EqualFold(r.Name, name) {
+			if found != nil {
+				return nil, fmt.Errorf("several rooms are named %q, use the id instead", name)
+			}
+			found = r
+		}
+	}
+
+	if found == nil {
+		return nil, fmt.Errorf("no room %q in home %s", name, h.Name)
+	}
+	return found, nil
+}
+
+// parseUntil parses a duration from now or a time in loc.
+func parseUntil(s string, now time.Time, loc *time.Location) (time.Time, error) {
+	if d, err := parseDays(s); err == nil {
+		return now.Add(d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, has to be a duration like 3d4h or a local time like 2006-01-02T15:04", s)
+}
+
+// parseDays parses a duration which may start with days, e.g. 3d4h.
+func parseDays(s string) (time.Duration, error) {
+	days, rest, ok := strings.Cut(s, "d")
+	if !ok {
+		return time.ParseDuration(s)
+	}
+
+	n, err := strconv.Atoi(days)
+	if err != nil {
+		return 0, err
+	}
+	d := time.Duration(n) * 24 * time.Hour
+	if rest == "" {
+		return d, nil
+	}
+
+	r, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, err
+	}
+	return d + r, nil
+}
+
+// parseInterspersed parses flags given before, between and after the
+// positional arguments and returns the latter. Like parseFlags, it adds the
+// logging flags and sets up the logger.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var lf logFlags
+	var pos []string
+	lf.register(fs)
+	for {
+		_ = fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		pos = append(pos, args[0])
+		args = args[1:]
+	}
+
+	if err := lf.setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return pos
+}
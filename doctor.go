@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tipok/netatmo_exporter/collector"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// maxClockSkew is the largest difference to the clock of the API which does
+// not disturb the expiry of tokens.
+const maxClockSkew = 30 * time.Second
+
+// doctor reports the result of checks with remediation hints for the ones
+// which failed.
+type doctor struct {
+	w      io.Writer
+	failed bool
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "[ok]   "+format+"\n", args...)
+}
+
+func (d *doctor) fail(hint string, format string, args ...interface{}) {
+	d.failed = true
+	fmt.Fprintf(d.w, "[fail] "+format+"\n", args...)
+	fmt.Fprintf(d.w, "       hint: %s\n", hint)
+}
+
+func runDoctor(args []string) {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	var cf clientFlags
+	var colf collectorFlags
+	cf.register(fs)
+	colf.register(fs)
+	parseFlags(fs, args)
+
+	d := &doctor{w: os.Stdout}
+	d.check(&cf, collector.Scopes(colf.collectors()...))
+	if d.failed {
+		os.Exit(1)
+	}
+}
+
+// check runs all checks, stopping at the first one later checks depend on.
+func (d *doctor) check(cf *clientFlags, required []string) {
+	client, err := cf.newClient(context.Background(), required...)
+	if err != nil {
+		d.fail(credentialsHint(err), "could not load credentials: %v", err)
+		return
+	}
+
+	token, err := client.Token()
+	if err != nil {
+		d.fail(credentialsHint(err), "could not obtain a token: %v", err)
+		return
+	}
+	d.ok("obtained a token")
+
+	d.checkScopes(token.Scopes, required)
+
+	homesData, err := client.GetHomesData()
+	if err != nil {
+		d.fail(requestHint(err), "could not fetch homes: %v", err)
+		return
+	}
+
+	d.checkClock(client.ServerTime(), time.Now())
+	d.checkHomes(homesData)
+}
+
+func (d *doctor) checkScopes(granted []string, required []string) {
+	if len(granted) == 0 {
+		d.fail("run the login command to obtain a token which records its scopes", "the scopes of the token are unknown, required are %s", strings.Join(required, " "))
+		return
+	}
+
+	has := make(map[string]bool)
+	for _, scope := range granted {
+		has[scope] = true
+	}
+
+	var missing []string
+	for _, scope := range required {
+		if !has[scope] {
+			missing = append(missing, scope)
+		}
+	}
+
+	if len(missing) > 0 {
+		d.fail(
+			fmt.Sprintf("run the login command with --scopes=%s, or disable the collectors needing them", strings.Join(required, ",")),
+			"the token lacks the scopes %s, granted are %s", strings.Join(missing, " "), strings.Join(granted, " "),
+		)
+		return
+	}
+	d.ok("the token has all required scopes: %s", strings.Join(required, " "))
+}
+
+func (d *doctor) checkClock(serverTime time.Time, now time.Time) {
+	if serverTime.IsZero() {
+		d.fail("check whether a proxy strips the response of the API", "the API did not report its time")
+		return
+	}
+
+	skew := now.Sub(serverTime).Round(time.Second)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		d.fail("synchronize the clock, e.g. with NTP; tokens expire too early or too late otherwise", "the clock is %s off the clock of the API", skew)
+		return
+	}
+	d.ok("the clock is %s off the clock of the API", skew)
+}
+
+func (d *doctor) checkHomes(homesData *netatmo.HomesData) {
+	if len(homesData.Homes) == 0 {
+		d.fail("check that the devices are assigned to a home in the Netatmo app of this account", "the account has no homes")
+		return
+	}
+
+	d.ok("the account has %d home(s)", len(homesData.Homes))
+	for _, h := range homesData.Homes {
+		types := make(map[string]int)
+		for _, m := range h.Modules {
+			types[m.Type]++
+		}
+
+		var counts []string
+		for t, n := range types {
+			counts = append(counts, fmt.Sprintf("%d %s", n, t))
+		}
+		sort.Strings(counts)
+
+		fmt.Fprintf(d.w, "       %s (%s): %d room(s), %d module(s)", h.Name, h.Id, len(h.Rooms), len(h.Modules))
+		if len(counts) > 0 {
+			fmt.Fprintf(d.w, ": %s", strings.Join(counts, ", "))
+		}
+		fmt.Fprintln(d.w)
+	}
+}
+
+// credentialsHint tells how to fix err, which occurred while obtaining a
+// token.
+func credentialsHint(err error) string {
+	switch {
+	case errors.Is(err, netatmo.ErrNoToken):
+		return "run the login command to write the token file, or pass --refresh-token"
+	case errors.Is(err, netatmo.ErrNeedsReauth):
+		return "the refresh token was revoked or already used, run the login command again"
+	default:
+		return "check --client-id and --client-secret and the token or credentials passed"
+	}
+}
+
+// requestHint tells how to fix err, which a request to the API failed with.
+func requestHint(err error) string {
+	switch {
+	case errors.Is(err, netatmo.ErrInvalidToken), errors.Is(err, netatmo.ErrNeedsReauth):
+		return "the token was rejected, run the login command again"
+	case errors.Is(err, netatmo.ErrRateLimited):
+		return "the request quota is exhausted, wait an hour and reduce how often the exporter is scraped"
+	default:
+		return "check the network connection to api.netatmo.com"
+	}
+}
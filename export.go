@@ -0,0 +1,489 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// exportModuleTypes are the measure types exported per module type. Rooms
+// export exportRoomTypes.
+var exportModuleTypes = map[string][]string{
+	"NATherm1": {netatmo.MeasureSumBoilerOn, netatmo.MeasureSumBoilerOff},
+	"OTM":      {netatmo.MeasureSumBoilerOn, netatmo.MeasureSumBoilerOff},
+	"NLPC":     {netatmo.MeasureSumEnergyElec},
+	"NLP":      {netatmo.MeasureSumEnergyElec},
+	"NLPM":     {netatmo.MeasureSumEnergyElec},
+	"NLPO":     {netatmo.MeasureSumEnergyElec},
+}
+
+var exportRoomTypes = []string{netatmo.MeasureTemperature, netatmo.MeasureSetPointTemperature}
+
+var exportHeader = []string{"timestamp", "home", "room", "module", "metric", "value"}
+
+// exportRow is a single measure, one row of the exported file.
+type exportRow struct {
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Home      string    `parquet:"home"`
+	Room      string    `parquet:"room"`
+	Module    string    `parquet:"module"`
+	Metric    string    `parquet:"metric"`
+	Value     float64   `parquet:"value"`
+}
+
+// exportSeries is a room or module whose measures are exported.
+type exportSeries struct {
+	key    string
+	home   *netatmo.Home
+	room   string
+	module string
+	types  []string
+	fetch  func(from time.Time, until time.Time) (*netatmo.ModuleMeasures, error)
+}
+
+// exportProgress is saved after every request, so that an interrupted
+// export continues where it stopped when it is run again.
+type exportProgress struct {
+	From   string `json:"from"`
+	Until  string `json:"until"`
+	Scale  string `json:"scale"`
+	Format string `json:"format"`
+	// Size is the size of the data file when the progress was saved.
+	// Rows written after it are written again on resume.
+	Size int64 `json:"size"`
+	// Done is the time of the last exported measure by series.
+	Done map[string]int64 `json:"done"`
+}
+
+func runExport(args []string) {
+	if err := export(args); err != nil {
+		fatal(err)
+	}
+}
+
+func export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var cf clientFlags
+	var from, until, scale, format, output, progressFile, home string
+	var wait time.Duration
+	cf.register(fs)
+	fs.StringVar(&from, "from", "", "Start of the export, a date like 2006-01-02 in the timezone of the home or an RFC 3339 time")
+	fs.StringVar(&until, "until", "", "End of the export like --from, now if not set")
+	fs.StringVar(&scale, "scale", netatmo.Scale1Hour, "Interval the measures are aggregated over: 5min, 30min, 1hour, 3hours, 1day, 1week or 1month")
+	fs.StringVar(&format, "format", "csv", "Output format: csv or parquet")
+	fs.StringVar(&output, "output", "", "File to export to")
+	fs.StringVar(&progressFile, "progress", "", "File keeping the progress of the export, the output file with .progress appended if not set")
+	fs.StringVar(&home, "home", "", "Only export the home with this id or name")
+	fs.DurationVar(&wait, "rate-limit-wait", 0, "How long to wait when rate limited before continuing; exits if not set, the export can be resumed by running it again")
+	parseFlags(fs, args)
+
+	if from == "" || output == "" {
+		return errors.New("--from and --output have to be provided")
+	}
+	if format != "csv" && format != "parquet" {
+		return fmt.Errorf("unknown format %q", format)
+	}
+	for _, t := range []string{from, until} {
+		if t == "" {
+			continue
+		}
+		if _, err := parseExportTime(t, time.UTC); err != nil {
+			return err
+		}
+	}
+	if progressFile == "" {
+		progressFile = output + ".progress"
+	}
+
+	dataFile := output
+	if format == "parquet" {
+		// parquet files cannot be appended to, so the rows are collected
+		// in a CSV file first and converted when the export is complete
+		dataFile = output + ".partial.csv"
+	}
+
+	progress, err := loadExportProgress(progressFile)
+	if err != nil {
+		return err
+	}
+	if progress == nil {
+		if until == "" {
+			until = time.Now().Format(time.RFC3339)
+		}
+		progress = &exportProgress{From: from, Until: until, Scale: scale, Format: format, Done: make(map[string]int64)}
+	} else {
+		if until == "" {
+			until = progress.Until
+		}
+		if progress.From != from || progress.Until != until || progress.Scale != scale || progress.Format != format {
+			return fmt.Errorf("%s belongs to another export, remove it to start over", progressFile)
+		}
+		slog.Info("Resuming export", "progress", progressFile)
+	}
+
+	client, err := cf.newClient(context.Background(), netatmo.ReadThermostat, netatmo.ReadMagellan)
+	if err != nil {
+		return err
+	}
+
+	homesData, err := client.GetHomesData()
+	if err != nil {
+		return err
+	}
+
+	var series []*exportSeries
+	for _, h := range homesData.Homes {
+		if home == "" || h.Id == home || h.Name == home {
+			series = append(series, newExportSeries(client, h, scale)...)
+		}
+	}
+
+	f, err := openExportData(dataFile, progress.Size)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	e := &exporter{
+		file:         f,
+		csv:          csv.NewWriter(f),
+		progress:     progress,
+		progressFile: progressFile,
+		wait:         wait,
+	}
+	for _, s := range series {
+		if err := e.export(s); err != nil {
+			return err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if format == "parquet" {
+		if err := convertToParquet(dataFile, output); err != nil {
+			return err
+		}
+		if err := os.Remove(dataFile); err != nil {
+			return err
+		}
+	}
+	return os.Remove(progressFile)
+}
+
+// newExportSeries returns the rooms and the modules with measures of h.
+func newExportSeries(client *netatmo.Client, h *netatmo.Home, scale string) []*exportSeries {
+	var series []*exportSeries
+	for _, r := range h.Rooms {
+		r := r
+		series = append(series, &exportSeries{
+			key:   "room/" + h.Id + "/" + r.Id,
+			home:  h,
+			room:  r.Name,
+			types: exportRoomTypes,
+			fetch: func(from time.Time, until time.Time) (*netatmo.ModuleMeasures, error) {
+				return client.GetRoomMeasure(h.Id, r.Id, exportRoomTypes, scale, from, until)
+			},
+		})
+	}
+
+	names := roomNames(h)
+	for _, m := range h.Modules {
+		m := m
+		types, ok := exportModuleTypes[m.Type]
+		if !ok || m.Bridge == "" {
+			continue
+		}
+		series = append(series, &exportSeries{
+			key:    "module/" + h.Id + "/" + m.Id,
+			home:   h,
+			room:   names[m.RoomId],
+			module: m.Id,
+			types:  types,
+			fetch: func(from time.Time, until time.Time) (*netatmo.ModuleMeasures, error) {
+				return client.GetMeasureScale(m, types, scale, from, until)
+			},
+		})
+	}
+	return series
+}
+
+// exporter writes the measures of series to file and keeps track of the
+// progress.
+type exporter struct {
+	file         *os.File
+	csv          *csv.Writer
+	progress     *exportProgress
+	progressFile string
+	wait         time.Duration
+}
+
+// export writes all measures of s not exported yet. The API returns a
+// limited number of measures per request, so they are fetched page by page
+// starting after the last one.
+func (e *exporter) export(s *exportSeries) error {
+	loc := s.home.Location()
+	from, err := parseExportTime(e.progress.From, loc)
+	if err != nil {
+		return err
+	}
+	until, err := parseExportTime(e.progress.Until, loc)
+	if err != nil {
+		return err
+	}
+
+	cursor := from
+	if done, ok := e.progress.Done[s.key]; ok {
+		cursor = time.Unix(done+1, 0)
+	}
+
+	for cursor.Before(until) {
+		measures, err := e.fetch(s, cursor, until)
+		if err != nil {
+			return err
+		}
+
+		last := cursor
+		found := false
+		for _, p := range measures.Measures {
+			t := time.Unix(p.Time, 0)
+			if t.Before(cursor) || t.After(until) {
+				continue
+			}
+			for _, metric := range s.types {
+				v, ok := p.Values[metric]
+				if !ok {
+					continue
+				}
+				if err := e.csv.Write(exportRecord(&exportRow{
+					Timestamp: t,
+					Home:      s.home.Name,
+					Room:      s.room,
+					Module:    s.module,
+					Metric:    metric,
+					Value:     v,
+				})); err != nil {
+					return err
+				}
+			}
+			found = true
+			if t.After(last) {
+				last = t
+			}
+		}
+
+		if !found {
+			// nothing new, the series is complete
+			break
+		}
+		if err := e.save(s.key, last); err != nil {
+			return err
+		}
+		cursor = last.Add(time.Second)
+	}
+
+	return e.save(s.key, until)
+}
+
+// fetch fetches measures of s, waiting when rate limited if configured to.
+func (e *exporter) fetch(s *exportSeries, from time.Time, until time.Time) (*netatmo.ModuleMeasures, error) {
+	for {
+		measures, err := s.fetch(from, until)
+		if !errors.Is(err, netatmo.ErrRateLimited) {
+			return measures, err
+		}
+		if e.wait <= 0 {
+			return nil, fmt.Errorf("rate limited, run the same command again to resume: %w", err)
+		}
+		slog.Warn("Rate limited, waiting", "series", s.key, "duration", e.wait)
+		time.Sleep(e.wait)
+	}
+}
+
+// save flushes the rows written so far and records that s is exported up
+// to t.
+func (e *exporter) save(key string, t time.Time) error {
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		return err
+	}
+	if err := e.file.Sync(); err != nil {
+		return err
+	}
+
+	size, err := e.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	e.progress.Size = size
+	e.progress.Done[key] = t.Unix()
+
+	b, err := json.MarshalIndent(e.progress, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := e.progressFile + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, e.progressFile)
+}
+
+func loadExportProgress(path string) (*exportProgress, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var p exportProgress
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", path, err)
+	}
+	if p.Done == nil {
+		p.Done = make(map[string]int64)
+	}
+	return &p, nil
+}
+
+// openExportData opens the data file for appending. Rows after size were
+// written after the progress was saved last and are dropped, as they are
+// exported again.
+func openExportData(path string, size int64) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.Truncate(size); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(size, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	if size == 0 {
+		w := csv.NewWriter(f)
+		_ = w.Write(exportHeader)
+		w.Flush()
+		if err := w.Error(); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func exportRecord(r *exportRow) []string {
+	return []string{
+		r.Timestamp.UTC().Format(time.RFC3339),
+		r.Home,
+		r.Room,
+		r.Module,
+		r.Metric,
+		strconv.FormatFloat(r.Value, 'f', -1, 64),
+	}
+}
+
+// convertToParquet writes the rows of the CSV file src to the Parquet file
+// dst.
+func convertToParquet(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	r := csv.NewReader(in)
+	if _, err := r.Read(); err != nil {
+		return fmt.Errorf("could not read header of %s: %w", src, err)
+	}
+
+	out, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+
+	w := parquet.NewGenericWriter[exportRow](out)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			_ = out.Close()
+			return err
+		}
+
+		row, err := parseExportRecord(record)
+		if err != nil {
+			_ = out.Close()
+			return err
+		}
+		if _, err := w.Write([]exportRow{*row}); err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+func parseExportRecord(record []string) (*exportRow, error) {
+	if len(record) != len(exportHeader) {
+		return nil, fmt.Errorf("row has %d instead of %d columns", len(record), len(exportHeader))
+	}
+
+	t, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return nil, err
+	}
+	v, err := strconv.ParseFloat(record[5], 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportRow{
+		Timestamp: t,
+		Home:      record[1],
+		Room:      record[2],
+		Module:    record[3],
+		Metric:    record[4],
+		Value:     v,
+	}, nil
+}
+
+// parseExportTime parses a date in loc or an RFC 3339 time.
+func parseExportTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, has to be a date like 2006-01-02 or an RFC 3339 time", s)
+}
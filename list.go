@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+	"gopkg.in/yaml.v3"
+)
+
+// inventory is what the list command prints: the homes with their rooms
+// and modules, reduced to what is needed to write queries and alerts.
+type inventory struct {
+	Homes []*inventoryHome `json:"homes" yaml:"homes"`
+}
+
+type inventoryHome struct {
+	Id      string             `json:"id" yaml:"id"`
+	Name    string             `json:"name" yaml:"name"`
+	Rooms   []*inventoryRoom   `json:"rooms" yaml:"rooms"`
+	Modules []*inventoryModule `json:"modules" yaml:"modules"`
+}
+
+type inventoryRoom struct {
+	Id   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+}
+
+type inventoryModule struct {
+	Id           string   `json:"id" yaml:"id"`
+	Name         string   `json:"name" yaml:"name"`
+	Type         string   `json:"type" yaml:"type"`
+	Bridge       string   `json:"bridge,omitempty" yaml:"bridge,omitempty"`
+	RoomId       string   `json:"room_id,omitempty" yaml:"room_id,omitempty"`
+	RoomName     string   `json:"room_name,omitempty" yaml:"room_name,omitempty"`
+	Firmware     *float64 `json:"firmware,omitempty" yaml:"firmware,omitempty"`
+	BatteryLevel *float64 `json:"battery_level,omitempty" yaml:"battery_level,omitempty"`
+	BatteryState *string  `json:"battery_state,omitempty" yaml:"battery_state,omitempty"`
+	Reachable    *bool    `json:"reachable,omitempty" yaml:"reachable,omitempty"`
+}
+
+func runList(args []string) {
+	if err := list(args); err != nil {
+		fatal(err)
+	}
+}
+
+func list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var cf clientFlags
+	var home, types, format string
+	cf.register(fs)
+	fs.StringVar(&home, "home", "", "Only list the home with this id or name")
+	fs.StringVar(&types, "type", "", "Only list modules of these comma separated types, e.g. NATherm1,NRV")
+	fs.StringVar(&format, "format", "table", "Output format: table, json or yaml")
+	parseFlags(fs, args)
+
+	write, ok := inventoryWriters[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q", format)
+	}
+
+	client, err := cf.newClient(context.Background(), netatmo.ReadThermostat)
+	if err != nil {
+		return err
+	}
+
+	homes, err := client.GetHomes()
+	if err != nil {
+		return err
+	}
+	for _, e := range homes.Errors {
+		slog.Warn("Status of home is missing", "home_id", e.Home.Id, "err", e.Err)
+	}
+
+	var moduleTypes []string
+	if types != "" {
+		moduleTypes = strings.Split(types, ",")
+	}
+	return write(os.Stdout, newInventory(homes, home, moduleTypes))
+}
+
+// newInventory returns the inventory of homes, only with the home matching
+// home by id or name if it is not empty, and only with modules of the given
+// types and the rooms they are in if types are given.
+func newInventory(homes *netatmo.Homes, home string, types []string) *inventory {
+	inv := &inventory{}
+	for _, h := range homes.Homes {
+		if home != "" && h.Id != home && h.Name != home {
+			continue
+		}
+
+		names := roomNames(h)
+		rooms := make(map[string]bool)
+		ih := &inventoryHome{Id: h.Id, Name: h.Name}
+		for _, m := range h.Modules {
+			if len(types) > 0 && !containsString(types, m.Type) {
+				continue
+			}
+
+			rooms[m.RoomId] = true
+			ih.Modules = append(ih.Modules, &inventoryModule{
+				Id:           m.Id,
+				Name:         m.Name,
+				Type:         m.Type,
+				Bridge:       m.Bridge,
+				RoomId:       m.RoomId,
+				RoomName:     names[m.RoomId],
+				Firmware:     m.FirmwareRevision,
+				BatteryLevel: m.BatteryLevel,
+				BatteryState: m.BatteryState,
+				Reachable:    m.Reachable,
+			})
+		}
+
+		for _, r := range h.Rooms {
+			if len(types) > 0 && !rooms[r.Id] {
+				continue
+			}
+			ih.Rooms = append(ih.Rooms, &inventoryRoom{Id: r.Id, Name: r.Name, Type: r.Type})
+		}
+
+		inv.Homes = append(inv.Homes, ih)
+	}
+	return inv
+}
+
+// inventoryWriters write an inventory by output format.
+var inventoryWriters = map[string]func(w io.Writer, inv *inventory) error{
+	"table": writeInventoryTable,
+	"json":  writeInventoryJSON,
+	"yaml":  writeInventoryYAML,
+}
+
+func writeInventoryJSON(w io.Writer, inv *inventory) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(inv)
+}
+
+func writeInventoryYAML(w io.Writer, inv *inventory) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(inv); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func writeInventoryTable(w io.Writer, inv *inventory) error {
+	for i, h := range inv.Homes {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "HOME %s (%s)\n\n", h.Name, h.Id)
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ROOM ID\tNAME\tTYPE")
+		for _, r := range h.Rooms {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Id, r.Name, orDash(r.Type))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "MODULE ID\tNAME\tTYPE\tBRIDGE\tROOM\tFIRMWARE\tBATTERY\tREACHABLE")
+		for _, m := range h.Modules {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				m.Id,
+				m.Name,
+				m.Type,
+				orDash(m.Bridge),
+				orDash(m.RoomName),
+				formatOptional(m.Firmware),
+				formatBattery(m),
+				formatReachable(m.Reachable),
+			)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatOptional(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func formatBattery(m *inventoryModule) string {
+	switch {
+	case m.BatteryLevel != nil && m.BatteryState != nil:
+		return fmt.Sprintf("%s (%s)", formatOptional(m.BatteryLevel), *m.BatteryState)
+	case m.BatteryState != nil:
+		return *m.BatteryState
+	default:
+		return formatOptional(m.BatteryLevel)
+	}
+}
+
+func formatReachable(v *bool) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.FormatBool(*v)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
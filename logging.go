@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// logFlags configure the logger of every command.
+type logFlags struct {
+	level  string
+	format string
+}
+
+func (f *logFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.level, "log.level", "info", "Only log messages with this level or above: debug, info, warn or error")
+	fs.StringVar(&f.format, "log.format", "logfmt", "Log format: logfmt or json")
+}
+
+// setup makes a logger as configured the default logger. Tokens and
+// secrets are redacted from all messages and attributes.
+func (f *logFlags) setup() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(f.level)); err != nil {
+		return fmt.Errorf("invalid log level %q", f.level)
+	}
+
+	opts := &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: netatmo.RedactAttr,
+	}
+
+	var handler slog.Handler
+	switch f.format {
+	case "logfmt":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", f.format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// parseFlags parses args with the logging flags added to fs and sets up the
+// logger.
+func parseFlags(fs *flag.FlagSet, args []string) {
+	var lf logFlags
+	lf.register(fs)
+	_ = fs.Parse(args)
+	if err := lf.setup(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// fatal logs err and exits with 1.
+func fatal(err error) {
+	fatalWithCode(err, 1)
+}
+
+// fatalWithCode logs err and exits with code, for commands which use 1 for
+// another outcome.
+func fatalWithCode(err error, code int) {
+	slog.Error("Command failed", "err", err)
+	os.Exit(code)
+}
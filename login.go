@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tipok/netatmo_exporter/collector"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// callbackResult is what the browser was redirected to the callback with.
+type callbackResult struct {
+	token *netatmo.StoredToken
+	err   error
+}
+
+func runLogin(args []string) {
+	if err := login(args); err != nil {
+		fatal(err)
+	}
+}
+
+// login authorizes the exporter in the browser and writes the token to the
+// token file, from where the exporter and the other commands pick it up.
+func login(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	var tf tokenStoreFlags
+	var clientID, clientSecret, redirect, scopes string
+	var timeout time.Duration
+	fs.StringVar(&clientID, "client-id", "", "Netatmo API client ID")
+	fs.StringVar(&clientSecret, "client-secret", "", "Netatmo API client secret")
+	tf.register(fs)
+	fs.StringVar(&redirect, "redirect-url", "http://localhost:8910/callback", "Local address Netatmo redirects to after access was granted")
+	fs.StringVar(&scopes, "scopes", strings.Join(loginScopes(), ","), "Comma separated scopes to request")
+	fs.DurationVar(&timeout, "timeout", 5*time.Minute, "How long to wait for access to be granted")
+	parseFlags(fs, args)
+
+	if clientID == "" || clientSecret == "" {
+		return errors.New("netatmo API client ID and secret have to be provided")
+	}
+	store, err := tf.store()
+	if err != nil {
+		return err
+	}
+
+	redirectURL, err := url.Parse(redirect)
+	if err != nil {
+		return fmt.Errorf("invalid redirect URL: %w", err)
+	}
+
+	cnf := &netatmo.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Scopes:       strings.Split(scopes, ","),
+	}
+	req, err := netatmo.NewAuthorizationRequest(cnf, redirect)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", redirectURL.Host)
+	if err != nil {
+		return fmt.Errorf("could not listen for the callback: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results := make(chan callbackResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectURL.Path, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var res callbackResult
+		if err := req.CheckState(q.Get("state")); err != nil {
+			res.err = err
+		} else if e := q.Get("error"); e != "" {
+			res.err = fmt.Errorf("access was not granted: %s", e)
+		} else {
+			res.token, res.err = req.Exchange(ctx, q.Get("state"), q.Get("code"))
+		}
+
+		if errors.Is(res.err, netatmo.ErrStateMismatch) {
+			// not the browser we sent, keep waiting for the right one
+			http.Error(w, res.err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if res.err != nil {
+			http.Error(w, res.err.Error(), http.StatusInternalServerError)
+		} else {
+			fmt.Fprintln(w, "Access granted, you can close this window.")
+		}
+
+		select {
+		case results <- res:
+		default:
+		}
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Callback server failed", "err", err)
+		}
+	}()
+	defer func() {
+		if err := srv.Shutdown(context.Background()); err != nil {
+			slog.Warn("Could not shut down callback server", "err", err)
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Open the following URL in your browser and grant access:\n\n%s\n\n", req.URL())
+
+	var res callbackResult
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		return errors.New("timed out waiting for access to be granted")
+	}
+	if res.err != nil {
+		return res.err
+	}
+
+	// replicas sharing the token file hold the lock while they refresh, so
+	// that none of them overwrites the new token with one refreshed from
+	// the old
+	unlock, err := store.Lock()
+	if err != nil {
+		return fmt.Errorf("could not lock token file: %w", err)
+	}
+	defer unlock()
+
+	if err := store.Save(res.token); err != nil {
+		return fmt.Errorf("could not write token: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Token written to %s\n", tf.tokenFile)
+	return nil
+}
+
+// loginScopes are the scopes all collectors and commands need.
+func loginScopes() []string {
+	return append(collector.Scopes(collector.Names()...), netatmo.WriteThermostat)
+}
@@ -3,73 +3,80 @@
 import (
 	"context"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	// homes report their schedules in local time, which has to work
+	// in minimal images without a timezone database as well
+	_ "time/tzdata"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/version"
+	"github.com/tipok/netatmo_exporter/collector"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
 )
 
-func main() {
-	var clientID string
-	var clientSecret string
-	var username string
-	var password string
-	var listen string
-	var refreshToken string
-	flag.StringVar(&clientID, "client-id", "", "Netatmo API client ID")
-	flag.StringVar(&clientSecret, "client-secret", "", "Netatmo API client secret")
-	flag.StringVar(&username, "username", "", "Netatmo username")
-	flag.StringVar(&password, "password", "", "Netatmo password")
-	flag.StringVar(&refreshToken, "refresh-token", "", "Netatmo refresh-token")
-	flag.StringVar(&listen, "listen", ":2112", "Address to listen on")
-	flag.Parse()
+// commands are the subcommands next to the exporter itself, which runs
+// when no subcommand is given.
+var commands = map[string]func(args []string){
+	"doctor":    runDoctor,
+	"export":    runExport,
+	"list":      runList,
+	"login":     runLogin,
+	"reset":     runReset,
+	"schedules": runSchedules,
+	"set":       runSet,
+	"token":     runToken,
+}
 
-	if clientID == "" {
-		log.Fatal("Netatmo API client ID has to be provided.")
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
 	}
 
-	if clientSecret == "" {
-		log.Fatal("Netatmo API client secret has to be provided.")
-	}
+	runExporter()
+}
 
-	refreshTokenUsed := false
-	if refreshToken != "" {
-		refreshTokenUsed = true
-	}
+func runExporter() {
+	var cf clientFlags
+	var colf collectorFlags
+	var listen, oneshotOutput string
+	var oneshot bool
+	cf.register(flag.CommandLine)
+	colf.register(flag.CommandLine)
+	flag.StringVar(&listen, "listen", ":2112", "Address to listen on")
+	flag.BoolVar(&oneshot, "oneshot", false, "Collect once, write the metrics to --oneshot.output and exit")
+	flag.StringVar(&oneshotOutput, "oneshot.output", "-", "File to write the metrics to in oneshot mode, e.g. for the textfile collector of node_exporter; - for stdout")
+	parseFlags(flag.CommandLine, os.Args[1:])
 
-	if username == "" && !refreshTokenUsed {
-		log.Fatal("Netatmo username has to be provided.")
+	client, err := cf.newClient(context.Background(), collector.Scopes(colf.collectors()...)...)
+	if err != nil {
+		if oneshot {
+			slog.Error("Could not authenticate", "err", err)
+			os.Exit(exitAuthFailure)
+		}
+		fatal(err)
 	}
 
-	if password == "" && !refreshTokenUsed {
-		log.Fatal("Netatmo password has to be provided.")
+	c, err := colf.newCollector(client)
+	if err != nil {
+		fatal(err)
 	}
 
-	prometheus.MustRegister(version.NewCollector("netatmo_exporter"))
-
-	cnf := &netatmo.Config{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		Username:     username,
-		Password:     password,
-		RefreshToken: refreshToken,
-		Scopes:       []string{netatmo.ReadStation, netatmo.ReadThermostat},
-	}
-	client, err := netatmo.NewClient(context.Background(), cnf)
-	if err != nil {
-		log.Fatal(err)
+	if oneshot {
+		os.Exit(runOneshot(client, c, oneshotOutput))
 	}
 
-	collector := newCollector(client)
-	prometheus.MustRegister(collector)
+	prometheus.MustRegister(version.NewCollector("netatmo_exporter"))
+	prometheus.MustRegister(c)
 
 	sig := make(chan os.Signal, 1)
 	signal.Notify(
@@ -81,15 +88,23 @@ func main() {
 
 	mux := http.NewServeMux()
 	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if client.NeedsReauth() {
+			http.Error(w, "needs re-authentication", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
 
 	srv := &http.Server{
 		Addr:    listen,
 		Handler: mux,
 	}
 
+	slog.Info("Listening", "address", listen)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 	}()
 
@@ -99,6 +114,6 @@ func main() {
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Printf("Error during shutdown: %v", err)
+		slog.Warn("Could not shut down", "err", err)
 	}
 }
@@ -4,24 +4,84 @@
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	homesData, _   = url.Parse("https://api.netatmo.com/api/homesdata")
-	homeStatus, _  = url.Parse("https://api.netatmo.com/api/homestatus")
-	roomMeasure, _ = url.Parse("https://api.netatmo.com/api/getroommeasure")
-	measure, _     = url.Parse("https://api.netatmo.com/api/getmeasure")
+	homesData, _      = url.Parse("https://api.netatmo.com/api/homesdata")
+	homeStatus, _     = url.Parse("https://api.netatmo.com/api/homestatus")
+	roomMeasure, _    = url.Parse("https://api.netatmo.com/api/getroommeasure")
+	measure, _        = url.Parse("https://api.netatmo.com/api/getmeasure")
+	stationsData, _   = url.Parse("https://api.netatmo.com/api/getstationsdata")
+	homeCoachsData, _ = url.Parse("https://api.netatmo.com/api/gethomecoachsdata")
+
+	syncHomeSchedule, _      = url.Parse("https://api.netatmo.com/api/synchomeschedule")
+	createNewHomeSchedule, _ = url.Parse("https://api.netatmo.com/api/createnewhomeschedule")
+	setRoomThermPoint, _     = url.Parse("https://api.netatmo.com/api/setroomthermpoint")
+	setThermMode, _          = url.Parse("https://api.netatmo.com/api/setthermmode")
+)
+
+const (
+	ReadThermostat  = "read_thermostat"
+	WriteThermostat = "write_thermostat"
+	ReadStation     = "read_station"
+	ReadHomeCoach   = "read_homecoach"
+	ReadMagellan    = "read_magellan"
+)
+
+// Measure types of GetMeasure.
+const (
+	MeasureTemperature         = "temperature"
+	MeasureSetPointTemperature = "sp_temperature"
+	MeasureSumBoilerOn         = "sum_boiler_on"
+	MeasureSumBoilerOff        = "sum_boiler_off"
+	MeasureSumEnergyElec       = "sum_energy_elec"
 )
 
+// Scales of measures, the interval measures are aggregated over.
 const (
-	ReadThermostat = "read_thermostat"
-	ReadStation    = "read_station"
+	Scale5Min   = "5min"
+	Scale30Min  = "30min"
+	Scale1Hour  = "1hour"
+	Scale3Hours = "3hours"
+	Scale1Day   = "1day"
+	Scale1Week  = "1week"
+	Scale1Month = "1month"
 )
 
+// API is the read-only part of the Netatmo API the exporter uses. Client
+// implements it against Netatmo, Memory serves data held in memory.
+type API interface {
+	GetHomesData() (*HomesData, error)
+	GetHomeStatus(home string) (*HomeStatus, error)
+	GetHomes() (*Homes, error)
+	GetMeasure(m *Module, types []string, from time.Time, until time.Time) (*ModuleMeasures, error)
+	GetStationsData() (*StationsData, error)
+	GetHomeCoachsData() (*HomeCoachsData, error)
+}
+
+var _ API = (*Client)(nil)
+
+type homeSchedule struct {
+	HomeId     string            `json:"home_id"`
+	ScheduleId string            `json:"schedule_id,omitempty"`
+	Name       string            `json:"name"`
+	HgTemp     *float64          `json:"hg_temp,omitempty"`
+	AwayTemp   *float64          `json:"away_temp,omitempty"`
+	Timetable  []*TimetableEntry `json:"timetable"`
+	Zones      []*Zone           `json:"zones"`
+}
+
+type newHomeSchedule struct {
+	ScheduleId string `json:"schedule_id"`
+}
+
 func (c *Client) GetHomesData() (*HomesData, error) {
 	var v HomesData
 	if err := c.get(homesData, &v); err != nil {
@@ -30,24 +90,94 @@ func (c *Client) GetHomesData() (*HomesData, error) {
 	return &v, nil
 }
 
+// GetStationsData returns the weather stations of the user.
+func (c *Client) GetStationsData() (*StationsData, error) {
+	stationsDataUrl, err := url.Parse(stationsData.String())
+	if err != nil {
+		return nil, err
+	}
+	q := stationsDataUrl.Query()
+	q.Add("get_favorites", "false")
+	stationsDataUrl.RawQuery = q.Encode()
+
+	var v StationsData
+	if err := c.get(stationsDataUrl, &v); err != nil {
+		return nil, fmt.Errorf("could not get stations data: %w", err)
+	}
+	return &v, nil
+}
+
+// GetHomeCoachsData returns the Healthy Home Coach devices of the user.
+func (c *Client) GetHomeCoachsData() (*HomeCoachsData, error) {
+	var v HomeCoachsData
+	if err := c.get(homeCoachsData, &v); err != nil {
+		return nil, fmt.Errorf("could not get home coachs data: %w", err)
+	}
+	return &v, nil
+}
+
+// GetHomes returns all homes with their status merged in. Homes whose
+// status could not be fetched are not part of Homes but reported in Errors,
+// so a failing home does not fail all others. The statuses are fetched
+// concurrently, at most Config.HomeStatusConcurrency at a time, and the homes
+// keep the order of homesdata. Once Netatmo rate limits a request, the
+// statuses not fetched yet are skipped instead of adding to the quota.
 func (c *Client) GetHomes() (*Homes, error) {
 	homesData, err := c.GetHomesData()
 	if err != nil {
 		return nil, fmt.Errorf("could not get homes data: %w", err)
 	}
 
-	var homes []*Home
-	for _, home := range homesData.Homes {
-		if homesStatus, err1 := c.GetHomeStatus(home.Id); err1 == nil {
-			home.Merge(homesStatus.Home)
-		} else {
-			log.Printf("Error during get home status: %v\n", err1)
+	return mergeHomeStatuses(homesData, c.homeStatusConcurrency, c.GetHomeStatus), nil
+}
+
+// mergeHomeStatuses fetches the status of every home of homesData with
+// getStatus, concurrency at a time, and merges it into the home.
+func mergeHomeStatuses(homesData *HomesData, concurrency int, getStatus func(home string) (*HomeStatus, error)) *Homes {
+	statuses := make([]*HomeStatus, len(homesData.Homes))
+	errs := make([]error, len(homesData.Homes))
+
+	var rateLimited atomic.Bool
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, home := range homesData.Homes {
+		wg.Add(1)
+		go func(i int, home *Home) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if rateLimited.Load() {
+				errs[i] = fmt.Errorf("skipped: %w", ErrRateLimited)
+				return
+			}
+
+			statuses[i], errs[i] = getStatus(home.Id)
+			if errors.Is(errs[i], ErrRateLimited) {
+				rateLimited.Store(true)
+			}
+		}(i, home)
+	}
+	wg.Wait()
+
+	homes := &Homes{}
+	for i, home := range homesData.Homes {
+		err := errs[i]
+		if err == nil && statuses[i].Home == nil {
+			err = errors.New("no home in status")
+		}
+		if err != nil {
+			slog.Warn("Could not get home status", "home_id", home.Id, "err", err)
+			homes.Errors = append(homes.Errors, &HomeError{Home: home, Err: err})
 			continue
 		}
-		homes = append(homes, home)
+
+		home.Merge(statuses[i].Home)
+		home.ModuleErrors = statuses[i].Errors
+		homes.Homes = append(homes.Homes, home)
 	}
 
-	return &Homes{Homes: homes}, nil
+	return homes
 }
 
 func (c *Client) GetHomeStatus(home string) (*HomeStatus, error) {
@@ -67,32 +197,124 @@ func (c *Client) GetHomeStatus(home string) (*HomeStatus, error) {
 	return &v, nil
 }
 
-func (c *Client) getRoomMeasure(home string, room string) (interface{}, error) {
+// SyncHomeSchedule replaces timetable, zones and temperatures of the
+// existing schedule s.Id of the given home by the ones of s.
+func (c *Client) SyncHomeSchedule(home string, s *Schedule) error {
+	if s.Id == "" {
+		return errors.New("schedule id has to be there")
+	}
+
+	if err := c.post(syncHomeSchedule, newHomeSchedulePayload(home, s), nil); err != nil {
+		return fmt.Errorf("could not sync schedule %s: %w", s.Id, err)
+	}
+	return nil
+}
+
+// CreateHomeSchedule creates s as a new schedule of the given home and
+// returns the id of the new schedule.
+func (c *Client) CreateHomeSchedule(home string, s *Schedule) (string, error) {
+	payload := newHomeSchedulePayload(home, s)
+	payload.ScheduleId = ""
+
+	var v newHomeSchedule
+	if err := c.post(createNewHomeSchedule, payload, &v); err != nil {
+		return "", fmt.Errorf("could not create schedule %s: %w", s.Name, err)
+	}
+	return v.ScheduleId, nil
+}
+
+func newHomeSchedulePayload(home string, s *Schedule) *homeSchedule {
+	return &homeSchedule{
+		HomeId:     home,
+		ScheduleId: s.Id,
+		Name:       s.Name,
+		HgTemp:     s.HgTemp,
+		AwayTemp:   s.AwayTemp,
+		Timetable:  s.Timetable,
+		Zones:      s.Zones,
+	}
+}
+
+// SetRoomThermPoint sets the set point mode of a room. With
+// SetPointModeManual the room is heated to temp, until the given time or
+// for the default duration of the home if until is zero. SetPointModeHome
+// lets the room follow the mode of the home again.
+func (c *Client) SetRoomThermPoint(home string, room string, mode string, temp *float64, until time.Time) error {
+	values := url.Values{}
+	values.Set("home_id", home)
+	values.Set("room_id", room)
+	values.Set("mode", mode)
+	if temp != nil {
+		values.Set("temp", strconv.FormatFloat(*temp, 'f', -1, 64))
+	}
+	if !until.IsZero() {
+		values.Set("endtime", strconv.FormatInt(until.Unix(), 10))
+	}
+
+	if err := c.postForm(setRoomThermPoint, values, nil); err != nil {
+		return fmt.Errorf("could not set room %s to %s: %w", room, mode, err)
+	}
+	return nil
+}
+
+// SetThermMode sets the mode of all rooms of the home, one of
+// ThermModeSchedule, ThermModeAway or ThermModeFrostGuard. Away and frost
+// guard last until the given time, or until changed if until is zero.
+func (c *Client) SetThermMode(home string, mode string, until time.Time) error {
+	values := url.Values{}
+	values.Set("home_id", home)
+	values.Set("mode", mode)
+	if !until.IsZero() {
+		values.Set("endtime", strconv.FormatInt(until.Unix(), 10))
+	}
+
+	if err := c.postForm(setThermMode, values, nil); err != nil {
+		return fmt.Errorf("could not set home %s to %s: %w", home, mode, err)
+	}
+	return nil
+}
+
+// GetRoomMeasure returns the measures of the given types of a room between
+// from and until, aggregated over scale. The API returns at most 1024
+// measures per request, later ones have to be fetched starting after the
+// last one returned.
+func (c *Client) GetRoomMeasure(home string, room string, types []string, scale string, from time.Time, until time.Time) (*ModuleMeasures, error) {
 	roomMeasureUrl, err := url.Parse(roomMeasure.String())
 	if err != nil {
 		return nil, err
 	}
 
+	if len(types) == 0 {
+		return nil, errors.New("at least one measure type has to be there")
+	}
+
 	q := roomMeasureUrl.Query()
 	q.Add("home_id", home)
 	q.Add("room_id", room)
-	q.Add("type", "heating_power_request,temperature,sp_temperature")
-	q.Add("scale", "5min")
+	q.Add("type", strings.Join(types, ","))
+	q.Add("scale", scale)
 	q.Add("real_time", "true")
-	now := time.Now()
-	d := time.Duration(-8) * time.Hour
-	q.Add("date_end", strconv.FormatInt(now.Unix(), 10))
-	q.Add("date_begin", strconv.FormatInt(now.Add(d).Unix(), 10))
+	q.Add("date_end", strconv.FormatInt(until.Unix(), 10))
+	q.Add("date_begin", strconv.FormatInt(from.Unix(), 10))
 	roomMeasureUrl.RawQuery = q.Encode()
 
-	var v interface{}
-	if err := c.get(roomMeasureUrl, &v); err != nil {
+	var objmap []map[string]*json.RawMessage
+	if err := c.get(roomMeasureUrl, &objmap); err != nil {
 		return nil, fmt.Errorf("could not get room measure data: %w", err)
 	}
-	return v, nil
+
+	return &ModuleMeasures{Measures: parseModuleMeasurePoints(objmap, types)}, nil
 }
 
-func (c *Client) GetMeasure(m *Module, from time.Time, until time.Time) (*ModuleMeasures, error) {
+// GetMeasure returns the measures of the given types of module m between
+// from and until in 5 minute steps.
+func (c *Client) GetMeasure(m *Module, types []string, from time.Time, until time.Time) (*ModuleMeasures, error) {
+	return c.GetMeasureScale(m, types, Scale5Min, from, until)
+}
+
+// GetMeasureScale is GetMeasure with measures aggregated over scale. Like
+// for GetRoomMeasure, at most 1024 measures are returned per request.
+func (c *Client) GetMeasureScale(m *Module, types []string, scale string, from time.Time, until time.Time) (*ModuleMeasures, error) {
 	measureUrl, err := url.Parse(measure.String())
 	if err != nil {
 		return nil, err
@@ -106,11 +328,15 @@ func (c *Client) GetMeasure(m *Module, from time.Time, until time.Time) (*Module
 		return nil, errors.New("module id has to be there")
 	}
 
+	if len(types) == 0 {
+		return nil, errors.New("at least one measure type has to be there")
+	}
+
 	q := measureUrl.Query()
 	q.Add("device_id", m.Bridge)
 	q.Add("module_id", m.Id)
-	q.Add("type", "sum_boiler_on,sum_boiler_off,temperature,sp_temperature")
-	q.Add("scale", "5min")
+	q.Add("type", strings.Join(types, ","))
+	q.Add("scale", scale)
 	q.Add("real_time", "true")
 	q.Add("date_end", strconv.FormatInt(until.Unix(), 10))
 	q.Add("date_begin", strconv.FormatInt(from.Unix(), 10))
@@ -121,65 +347,56 @@ func (c *Client) GetMeasure(m *Module, from time.Time, until time.Time) (*Module
 		return nil, fmt.Errorf("could not get measure data: %w", err)
 	}
 
-	mps := parseModuleMeasurePoints(objmap)
+	mps := parseModuleMeasurePoints(objmap, types)
 
 	return &ModuleMeasures{Measures: mps}, nil
 }
 
-func parseModuleMeasurePoints(objmap []map[string]*json.RawMessage) []*ModuleMeasurePoint {
+func parseModuleMeasurePoints(objmap []map[string]*json.RawMessage, types []string) []*ModuleMeasurePoint {
 	var mps []*ModuleMeasurePoint
 	for _, p := range objmap {
+		bto, ok1 := p["beg_time"]
+		stepo, ok2 := p["step_time"]
+		if !ok1 || !ok2 || bto == nil || stepo == nil {
+			slog.Warn("Measure without beg_time or step_time")
+			continue
+		}
 		var bt int64
-		if err := json.Unmarshal(*p["beg_time"], &bt); err != nil {
-			log.Printf("Error during unmarshal of beg_time: %v\n", err)
+		if err := json.Unmarshal(*bto, &bt); err != nil {
+			slog.Warn("Could not decode beg_time of measure", "err", err)
 			continue
 		}
 		var step uint32
-		if err := json.Unmarshal(*p["step_time"], &step); err != nil {
-			log.Printf("Error during unmarshal of step_time: %v\n", err)
+		if err := json.Unmarshal(*stepo, &step); err != nil {
+			slog.Warn("Could not decode step_time of measure", "err", err)
+			continue
+		}
+		vr, ok := p["value"]
+		if !ok || vr == nil {
 			continue
 		}
-		if vr, ok := p["value"]; ok {
-			var values [][]*json.RawMessage
-			if err := json.Unmarshal(*vr, &values); err == nil {
-				for i, value := range values {
-					var bon uint16
-					var boff uint16
-					var t float64
-					var spt float64
-					if value[0] != nil {
-						if err := json.Unmarshal(*value[0], &bon); err != nil {
-							log.Printf("Error during unmarshal first value: %v\n", err)
-						}
-					}
-					if value[1] != nil {
-						if err := json.Unmarshal(*value[1], &boff); err != nil {
-							log.Printf("Error during unmarshal second value: %v\n", err)
-						}
-					}
-					if value[2] != nil {
-						if err := json.Unmarshal(*value[2], &t); err != nil {
-							log.Printf("Error during unmarshal third value: %v\n", err)
-						}
-					}
-					if value[3] != nil {
-						if err := json.Unmarshal(*value[3], &spt); err != nil {
-							log.Printf("Error during unmarshal fourth value: %v\n", err)
-						}
-					}
-					pt := bt + (int64(step) * int64(i))
-					mp := &ModuleMeasurePoint{
-						Time:                pt,
-						SumBoilerOn:         bon,
-						SumBoilerOff:        boff,
-						MeasuredTemperature: t,
-						SetPointTemperature: spt,
-					}
-					mps = append(mps, mp)
+		var values [][]*json.RawMessage
+		if err := json.Unmarshal(*vr, &values); err != nil {
+			slog.Warn("Could not decode values of measure", "err", err)
+			continue
+		}
+		for i, value := range values {
+			mp := &ModuleMeasurePoint{
+				Time:   bt + (int64(step) * int64(i)),
+				Values: make(map[string]float64),
+			}
+			for j, t := range types {
+				if j >= len(value) || value[j] == nil {
+					continue
+				}
+				var v float64
+				if err := json.Unmarshal(*value[j], &v); err != nil {
+					slog.Warn("Could not decode value of measure", "type", t, "err", err)
+					continue
 				}
-			} else {
-				log.Printf("Error during unmarshal: %v\n", err)
+				mp.Values[t] = v
 			}
+			mps = append(mps, mp)
 		}
 	}
 	return mps
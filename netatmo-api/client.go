@@ -1,13 +1,19 @@
 package netatmo_api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -17,6 +23,8 @@
 	tokenURL = "https://api.netatmo.com/oauth2/token"
 )
 
+const defaultHomeStatusConcurrency = 4
+
 // Config contains configuration for OAuth2
 type Config struct {
 	Username     string
@@ -25,25 +33,42 @@ type Config struct {
 	ClientID     string
 	ClientSecret string
 	Scopes       []string
+	// TokenStore keeps the token across restarts. A stored token takes
+	// precedence over RefreshToken and the password, and every refreshed
+	// token is saved to it.
+	TokenStore TokenStore
+	// HomeStatusConcurrency limits how many home statuses GetHomes fetches
+	// at the same time, 4 if not set.
+	HomeStatusConcurrency int
 }
 
 // Client working with netatmo API
 type Client struct {
-	httpClient *http.Client
-	ctx        context.Context
+	httpClient            *http.Client
+	tokens                *storeTokenSource
+	ctx                   context.Context
+	homeStatusConcurrency int
+	serverTime            atomic.Int64
 }
 
 // NewClient creates a new authenticated client
 func NewClient(ctx context.Context, cnf *Config) (*Client, error) {
 
-	httpClient, err := getOauthClient(ctx, cnf)
+	tokens, err := getTokenSource(ctx, cnf)
 	if err != nil {
 		return nil, err
 	}
 
+	concurrency := cnf.HomeStatusConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultHomeStatusConcurrency
+	}
+
 	return &Client{
-		httpClient: httpClient,
-		ctx:        ctx,
+		httpClient:            oauth2.NewClient(ctx, nil),
+		tokens:                tokens,
+		ctx:                   ctx,
+		homeStatusConcurrency: concurrency,
 	}, nil
 }
 
@@ -59,7 +84,7 @@ func getOauthToken(ctx context.Context, oauth *oauth2.Config, cnf *Config) (*oau
 
 }
 
-func getOauthClient(ctx context.Context, cnf *Config) (*http.Client, error) {
+func getTokenSource(ctx context.Context, cnf *Config) (*storeTokenSource, error) {
 	oauth := &oauth2.Config{
 		ClientID:     cnf.ClientID,
 		ClientSecret: cnf.ClientSecret,
@@ -70,19 +95,66 @@ func getOauthClient(ctx context.Context, cnf *Config) (*http.Client, error) {
 		},
 	}
 
-	token, err := getOauthToken(ctx, oauth, cnf)
-	if err != nil {
+	store := cnf.TokenStore
+	if store == nil {
+		store = &memoryTokenStore{}
+	}
+
+	stored, err := store.Load()
+	switch {
+	case errors.Is(err, ErrNoToken):
+		if cnf.RefreshToken == "" && cnf.Username == "" {
+			return nil, fmt.Errorf("no credentials configured: %w", err)
+		}
+		token, err := getOauthToken(ctx, oauth, cnf)
+		if err != nil {
+			return nil, err
+		}
+		stored = &StoredToken{Token: token, Scopes: grantedScopes(token), ObtainedAt: time.Now()}
+		if err := store.Save(stored); err != nil {
+			return nil, fmt.Errorf("could not save token: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("could not load token: %w", err)
+	}
+
+	return &storeTokenSource{
+		ctx:    ctx,
+		oauth:  oauth,
+		store:  store,
+		stored: stored,
+	}, nil
+}
+
+// Token returns the current token, refreshing it if necessary.
+func (c *Client) Token() (*StoredToken, error) {
+	if _, err := c.tokens.Token(); err != nil {
 		return nil, err
 	}
-	httpClient := oauth.Client(ctx, token)
+	return c.tokens.current(), nil
+}
 
-	return httpClient, nil
+// ServerTime returns the time the API reported with its last successful
+// response, or the zero time if there was none yet.
+func (c *Client) ServerTime() time.Time {
+	serverTime := c.serverTime.Load()
+	if serverTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(serverTime, 0)
+}
+
+// NeedsReauth reports whether the token endpoint rejected the refresh
+// token, so that the client has to be authorized again. The client keeps
+// retrying to refresh with a backoff in the meantime.
+func (c *Client) NeedsReauth() bool {
+	return c.tokens.needsReauth()
 }
 
 func closeBody(res *http.Response) {
 	err := res.Body.Close()
 	if err != nil {
-		log.Printf("Error during body close: %v\n", err)
+		slog.Warn("Could not close body", "err", err)
 	}
 }
 
@@ -95,12 +167,73 @@ func (c *Client) get(u *url.URL, v interface{}) error {
 	return c.request(req, v)
 }
 
+func (c *Client) post(u *url.URL, payload interface{}, v interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return c.request(req, v)
+}
+
+// postForm posts values form encoded, as the endpoints changing the state
+// of rooms and homes expect.
+func (c *Client) postForm(u *url.URL, values url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, u.String(), strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.request(req, v)
+}
+
+// request executes req and decodes the body of the response into v. Write
+// endpoints only report a status, for those v may be nil. If the API
+// rejects the access token, it is refreshed and req is sent once more.
 func (c *Client) request(req *http.Request, v interface{}) error {
+	accessToken, err := c.send(req, v)
+	if !errors.Is(err, ErrInvalidToken) {
+		return err
+	}
+
+	c.tokens.invalidate(accessToken)
+	if req.GetBody != nil {
+		if req.Body, err = req.GetBody(); err != nil {
+			return err
+		}
+	}
+	_, err = c.send(req, v)
+	return err
+}
+
+// send executes req authorized with the current token and returns the
+// access token it was sent with.
+func (c *Client) send(req *http.Request, v interface{}) (string, error) {
+	token, err := c.tokens.Token()
+	if err != nil {
+		return "", err
+	}
+	token.SetAuthHeader(req)
+
+	return token.AccessToken, c.do(req, v)
+}
+
+func (c *Client) do(req *http.Request, v interface{}) error {
+	begin := time.Now()
 	res, err := c.httpClient.Do(req)
 	if err != nil {
+		slog.Debug("API request failed", "endpoint", req.URL.Path, "duration", time.Since(begin), "err", err)
 		return fmt.Errorf("error during http request: %w", err)
 	}
 	defer closeBody(res)
+	slog.Debug("API request", "endpoint", req.URL.Path, "status", res.StatusCode, "duration", time.Since(begin))
 
 	switch res.StatusCode {
 	case http.StatusOK:
@@ -108,17 +241,35 @@ func (c *Client) request(req *http.Request, v interface{}) error {
 		if err := json.NewDecoder(res.Body).Decode(&objmap); err != nil {
 			return fmt.Errorf("could not decode json: %w", err)
 		}
+		var serverTime int64
+		if err := json.Unmarshal(objmap["time_server"], &serverTime); err == nil {
+			c.serverTime.Store(serverTime)
+		}
+		if v == nil {
+			return nil
+		}
 		if body, ok := objmap["body"]; ok {
 			if err := json.Unmarshal(body, &v); err != nil {
 				return fmt.Errorf("could not decode body: %w", err)
 			}
 			return nil
 		}
-		return fmt.Errorf("could not find body: %v", objmap)
+		// only the keys, the values may hold secrets like tokens
+		return fmt.Errorf("could not find body, keys: %v", jsonKeys(objmap))
 	default:
 		bodyString, _ := readString(res)
-		return fmt.Errorf("invalid request: status_code = %d content=%v", res.StatusCode, bodyString)
+		return newAPIError(res.StatusCode, bodyString)
+	}
+}
+
+// jsonKeys returns the sorted keys of a JSON object.
+func jsonKeys(objmap map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(objmap))
+	for k := range objmap {
+		keys = append(keys, k)
 	}
+	sort.Strings(keys)
+	return keys
 }
 
 func readString(resp *http.Response) (string, error) {
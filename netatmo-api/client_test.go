@@ -0,0 +1,33 @@
+package netatmo_api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientDoWithoutBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok","time_server":1700000000,"access_token":"at-secret"}`))
+	}))
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Client{httpClient: srv.Client()}
+	var v HomesData
+	err = c.do(req, &v)
+	if err == nil {
+		t.Fatal("do succeeded without body")
+	}
+	if strings.Contains(err.Error(), "at-secret") {
+		t.Errorf("error contains the response: %v", err)
+	}
+	if want := "could not find body, keys: [access_token status time_server]"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
@@ -1,162 +1,239 @@
 package netatmo_api
 
+import "fmt"
+
 type HomesData struct {
 	Homes []*Home `json:"homes"`
 }
 
 type Homes struct {
-	Homes []*Home `json:"homes"`
+	Homes  []*Home      `json:"homes"`
+	Errors []*HomeError `json:"-"`
 }
 
-type HomeStatus struct {
-	Home *Home `json:"home"`
+// HomeError tells why the status of a home could not be fetched.
+type HomeError struct {
+	Home *Home
+	Err  error
 }
 
-type Home struct {
-	Altitude    uint32    `json:"altitude"`
-	Country     string    `json:"country"`
-	Id          string    `json:"id"`
-	Name        string    `json:"name"`
-	Coordinates []float64 `json:"coordinates"`
-	Modules     []*Module `json:"modules"`
-	Rooms       []*Room   `json:"rooms"`
+func (e *HomeError) Error() string {
+	return fmt.Sprintf("home %s: %v", e.Home.Id, e.Err)
 }
 
-type Module struct {
-	Id               string  `json:"id"`
-	Reachable        bool    `json:"reachable"`
-	Type             string  `json:"type"`
-	Bridge           string  `json:"bridge"`
-	Anticipating     bool    `json:"anticipating"`
-	FirmwareRevision float64 `json:"firmware_revision"`
-	RfStrength       float64 `json:"rf_strength"`
-	WifiStrength     float64 `json:"wifi_strength"`
-	BatteryLevel     float64 `json:"battery_level"`
-	BatteryState     string  `json:"battery_state"`
-	BoilerStatus     bool    `json:"boiler_status"`
-	RoomId           string  `json:"room_id"`
+func (e *HomeError) Unwrap() error {
+	return e.Err
 }
 
-type Room struct {
-	Reachable           bool    `json:"reachable"`
-	Id                  string  `json:"id"`
-	Name                string  `json:"name"`
-	Anticipating        bool    `json:"anticipating"`
-	OpenWindow          bool    `json:"open_window"`
-	MeasuredTemperature float64 `json:"therm_measured_temperature"`
-	SetPointTemperature float64 `json:"therm_setpoint_temperature"`
-	SetPointStartTime   uint64  `json:"therm_setpoint_start_time"`
-	SetPointEndTime     uint64  `json:"therm_setpoint_end_time"`
-	SetPointMode        string  `json:"therm_setpoint_mode"`
+// HomeStatus is the body of homestatus. Errors of modules are reported next
+// to the home, GetHomes copies them onto Home.ModuleErrors.
+type HomeStatus struct {
+	Home   *Home          `json:"home"`
+	Errors []*ModuleError `json:"errors"`
 }
 
-type ModuleMeasures struct {
-	Measures []*ModuleMeasurePoint `json:"measures"`
+type Home struct {
+	Altitude                     uint32         `json:"altitude"`
+	Country                      string         `json:"country"`
+	Id                           string         `json:"id"`
+	Name                         string         `json:"name"`
+	Coordinates                  []float64      `json:"coordinates"`
+	Timezone                     string         `json:"timezone"`
+	TemperatureControlMode       string         `json:"temperature_control_mode"`
+	ThermMode                    string         `json:"therm_mode"`
+	ThermSetPointDefaultDuration uint32         `json:"therm_setpoint_default_duration"`
+	ThermSchedules               []*Schedule    `json:"therm_schedules"`
+	Schedules                    []*Schedule    `json:"schedules"`
+	Modules                      []*Module      `json:"modules"`
+	Rooms                        []*Room        `json:"rooms"`
+	ModuleErrors                 []*ModuleError `json:"-"`
 }
 
-type ModuleMeasurePoint struct {
-	Time                int64   `json:"time"`
-	SumBoilerOn         uint16  `json:"sum_boiler_on"`
-	SumBoilerOff        uint16  `json:"sum_boiler_off"`
-	MeasuredTemperature float64 `json:"therm_measured_temperature"`
-	SetPointTemperature float64 `json:"therm_setpoint_temperature"`
+// Schedule is a weekly heating schedule of a home as reported by homesdata.
+type Schedule struct {
+	Id        string            `json:"id"`
+	Name      string            `json:"name"`
+	Type      string            `json:"type"`
+	Default   bool              `json:"default"`
+	Selected  bool              `json:"selected"`
+	AwayTemp  *float64          `json:"away_temp"`
+	HgTemp    *float64          `json:"hg_temp"`
+	Timetable []*TimetableEntry `json:"timetable"`
+	Zones     []*Zone           `json:"zones"`
 }
 
-func (r *Room) Merge(r2 *Room) {
-	if r.Reachable == false {
-		r.Reachable = r2.Reachable
-	}
-
-	if r.Name == "" {
-		r.Name = r2.Name
-	}
-
-	if r.Anticipating == false {
-		r.Anticipating = r2.Anticipating
-	}
+// TimetableEntry switches a schedule to a zone. MOffset is the number of
+// minutes since Monday 00:00 in the timezone of the home.
+type TimetableEntry struct {
+	ZoneId  int `json:"zone_id"`
+	MOffset int `json:"m_offset"`
+}
 
-	if r.OpenWindow == false {
-		r.OpenWindow = r2.OpenWindow
-	}
+// Zone is a named set of room temperatures a schedule can switch to,
+// e.g. "Comfort" or "Night".
+type Zone struct {
+	Id    int         `json:"id"`
+	Name  string      `json:"name"`
+	Type  int         `json:"type"`
+	Rooms []*ZoneRoom `json:"rooms"`
+}
 
-	if r.MeasuredTemperature == 0 {
-		r.MeasuredTemperature = r2.MeasuredTemperature
-	}
+// ZoneRoom is the target temperature of a room within a zone.
+type ZoneRoom struct {
+	Id                  string  `json:"id"`
+	SetPointTemperature float64 `json:"therm_setpoint_temperature"`
+}
 
-	if r.SetPointTemperature == 0 {
-		r.SetPointTemperature = r2.SetPointTemperature
-	}
+// Module is a device of a home. Fields which are only reported by the
+// homestatus endpoint are pointers, so that a value the API did not send
+// (e.g. because the module is unreachable) can be told apart from zero.
+type Module struct {
+	Id               string   `json:"id"`
+	Name             string   `json:"name"`
+	Reachable        *bool    `json:"reachable"`
+	Type             string   `json:"type"`
+	Bridge           string   `json:"bridge"`
+	Anticipating     *bool    `json:"anticipating"`
+	FirmwareRevision *float64 `json:"firmware_revision"`
+	RfStrength       *float64 `json:"rf_strength"`
+	WifiStrength     *float64 `json:"wifi_strength"`
+	BatteryLevel     *float64 `json:"battery_level"`
+	BatteryState     *string  `json:"battery_state"`
+	BoilerStatus     *bool    `json:"boiler_status"`
+	Power            *float64 `json:"power"`
+	On               *bool    `json:"on"`
+	Brightness       *float64 `json:"brightness"`
+	RoomId           string   `json:"room_id"`
+	ModulesBridged   []string `json:"modules_bridged"`
+}
 
-	if r.SetPointStartTime == 0 {
-		r.SetPointStartTime = r2.SetPointStartTime
-	}
+// Room is a room of a home. Like for Module, the measured values are
+// pointers and nil when the API did not report them.
+type Room struct {
+	Reachable           *bool    `json:"reachable"`
+	Id                  string   `json:"id"`
+	Name                string   `json:"name"`
+	Type                string   `json:"type"`
+	ModuleIds           []string `json:"module_ids"`
+	Anticipating        *bool    `json:"anticipating"`
+	OpenWindow          *bool    `json:"open_window"`
+	MeasuredTemperature *float64 `json:"therm_measured_temperature"`
+	SetPointTemperature *float64 `json:"therm_setpoint_temperature"`
+	SetPointStartTime   *uint64  `json:"therm_setpoint_start_time"`
+	SetPointEndTime     *uint64  `json:"therm_setpoint_end_time"`
+	SetPointMode        *string  `json:"therm_setpoint_mode"`
+}
 
-	if r.SetPointEndTime == 0 {
-		r.SetPointEndTime = r2.SetPointEndTime
-	}
+// IsReachable reports whether the module is known to be reachable.
+func (m *Module) IsReachable() bool {
+	return m.Reachable != nil && *m.Reachable
+}
 
-	if r.SetPointMode == "" {
-		r.SetPointMode = r2.SetPointMode
-	}
+// IsUnreachable reports whether the module is known to be unreachable.
+// Bridges and relays like the NAPlug are not reported with reachable at
+// all, so this is not the opposite of IsReachable.
+func (m *Module) IsUnreachable() bool {
+	return m.Reachable != nil && !*m.Reachable
 }
 
-func (m *Module) Merge(m2 *Module) {
-	if m.Reachable == false {
-		m.Reachable = m2.Reachable
-	}
+// IsReachable reports whether the room is known to be reachable.
+func (r *Room) IsReachable() bool {
+	return r.Reachable != nil && *r.Reachable
+}
 
-	if m.Anticipating == false {
-		m.Anticipating = m2.Anticipating
-	}
+// IsUnreachable reports whether the room is known to be unreachable.
+func (r *Room) IsUnreachable() bool {
+	return r.Reachable != nil && !*r.Reachable
+}
 
-	if m.Type == "" {
-		m.Type = m2.Type
-	}
+type ModuleMeasures struct {
+	Measures []*ModuleMeasurePoint `json:"measures"`
+}
 
-	if m.FirmwareRevision == 0 {
-		m.FirmwareRevision = m2.FirmwareRevision
-	}
+// ModuleMeasurePoint are the measures of a module at a point in time, by
+// measure type. Types the API did not report a value for are missing.
+type ModuleMeasurePoint struct {
+	Time   int64              `json:"time"`
+	Values map[string]float64 `json:"values"`
+}
 
-	if m.RfStrength == 0 {
-		m.RfStrength = m2.RfStrength
+// Merge merges the room status reported by homestatus into r, which is
+// expected to come from homesdata. homesdata is authoritative for the
+// topology (id, name), so those fields are only filled in when missing.
+// homestatus is authoritative for all dynamic fields: they are taken over
+// as reported, including explicit false and zero values, and are absent
+// (nil) when homestatus did not report them.
+func (r *Room) Merge(status *Room) {
+	if r.Name == "" {
+		r.Name = status.Name
 	}
 
-	if m.BoilerStatus == false {
-		m.BoilerStatus = m2.BoilerStatus
-	}
+	r.Reachable = status.Reachable
+	r.Anticipating = status.Anticipating
+	r.OpenWindow = status.OpenWindow
+	r.MeasuredTemperature = status.MeasuredTemperature
+	r.SetPointTemperature = status.SetPointTemperature
+	r.SetPointStartTime = status.SetPointStartTime
+	r.SetPointEndTime = status.SetPointEndTime
+	r.SetPointMode = status.SetPointMode
+}
 
-	if m.WifiStrength == 0 {
-		m.WifiStrength = m2.WifiStrength
+// Merge merges the module status reported by homestatus into m following
+// the same rules as Room.Merge: name, type, bridge and room come from homesdata,
+// everything else from homestatus.
+func (m *Module) Merge(status *Module) {
+	if m.Name == "" {
+		m.Name = status.Name
 	}
 
-	if m.BatteryLevel == 0 {
-		m.BatteryLevel = m2.BatteryLevel
+	if m.Type == "" {
+		m.Type = status.Type
 	}
 
-	if m.BatteryState == "" {
-		m.BatteryState = m2.BatteryState
+	if m.Bridge == "" {
+		m.Bridge = status.Bridge
 	}
 
 	if m.RoomId == "" {
-		m.RoomId = m2.RoomId
+		m.RoomId = status.RoomId
 	}
+
+	m.Reachable = status.Reachable
+	m.Anticipating = status.Anticipating
+	m.FirmwareRevision = status.FirmwareRevision
+	m.RfStrength = status.RfStrength
+	m.WifiStrength = status.WifiStrength
+	m.BatteryLevel = status.BatteryLevel
+	m.BatteryState = status.BatteryState
+	m.BoilerStatus = status.BoilerStatus
+	m.Power = status.Power
+	m.On = status.On
+	m.Brightness = status.Brightness
 }
 
-func (h *Home) Merge(h2 *Home) {
+// Merge merges the home status reported by homestatus into h, which is
+// expected to come from homesdata. The home itself only carries topology,
+// so its fields are only filled in when homesdata did not provide them;
+// rooms and modules are merged one by one by their id.
+func (h *Home) Merge(status *Home) {
 	if h.Name == "" {
-		h.Name = h2.Name
+		h.Name = status.Name
+	}
+
+	if h.Country == "" {
+		h.Country = status.Country
 	}
 
 	if h.Altitude == 0 {
-		h.Altitude = h2.Altitude
+		h.Altitude = status.Altitude
 	}
 
 	if len(h.Coordinates) == 0 {
-		h.Coordinates = h2.Coordinates
+		h.Coordinates = status.Coordinates
 	}
 
-	mergeRooms(h, h2)
-	mergeModules(h, h2)
+	mergeRooms(h, status)
+	mergeModules(h, status)
 }
 
 func mergeRooms(h *Home, h2 *Home) {
@@ -179,8 +256,12 @@ func mergeRooms(h *Home, h2 *Home) {
 		rooms = append(rooms, r)
 	}
 
-	for _, r2 := range h2rm {
-		rooms = append(rooms, r2)
+	// rooms only known to homestatus are added in its order, so the
+	// result does not depend on map iteration
+	for _, r2 := range h2.Rooms {
+		if _, ok := h2rm[r2.Id]; ok {
+			rooms = append(rooms, r2)
+		}
 	}
 
 	h.Rooms = rooms
@@ -206,8 +287,10 @@ func mergeModules(h *Home, h2 *Home) {
 		modules = append(modules, m)
 	}
 
-	for _, m2 := range h2mm {
-		modules = append(modules, m2)
+	for _, m2 := range h2.Modules {
+		if _, ok := h2mm[m2.Id]; ok {
+			modules = append(modules, m2)
+		}
 	}
 
 	h.Modules = modules
@@ -0,0 +1,244 @@
+package netatmo_api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func boolPtr(v bool) *bool        { return &v }
+func floatPtr(v float64) *float64 { return &v }
+func stringPtr(v string) *string  { return &v }
+func uint64Ptr(v uint64) *uint64  { return &v }
+
+func toJSON(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRoomMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		room   Room
+		status Room
+		want   Room
+	}{
+		{
+			name:   "explicit false and zero override homesdata",
+			room:   Room{Id: "r1", Name: "Living", Reachable: boolPtr(true), OpenWindow: boolPtr(true), MeasuredTemperature: floatPtr(21)},
+			status: Room{Id: "r1", Reachable: boolPtr(false), OpenWindow: boolPtr(false), MeasuredTemperature: floatPtr(0), SetPointTemperature: floatPtr(0)},
+			want:   Room{Id: "r1", Name: "Living", Reachable: boolPtr(false), OpenWindow: boolPtr(false), MeasuredTemperature: floatPtr(0), SetPointTemperature: floatPtr(0)},
+		},
+		{
+			name:   "fields left out by homestatus stay nil",
+			room:   Room{Id: "r1", Name: "Living", Anticipating: boolPtr(true), SetPointEndTime: uint64Ptr(1700000000)},
+			status: Room{Id: "r1", Reachable: boolPtr(true)},
+			want:   Room{Id: "r1", Name: "Living", Reachable: boolPtr(true)},
+		},
+		{
+			name:   "all dynamic fields are taken over",
+			room:   Room{Id: "r1", Name: "Living", Type: "livingroom", ModuleIds: []string{"m1"}},
+			status: Room{Id: "r1", Reachable: boolPtr(true), Anticipating: boolPtr(false), OpenWindow: boolPtr(false), MeasuredTemperature: floatPtr(20.5), SetPointTemperature: floatPtr(19), SetPointStartTime: uint64Ptr(1), SetPointEndTime: uint64Ptr(2), SetPointMode: stringPtr("schedule")},
+			want:   Room{Id: "r1", Name: "Living", Type: "livingroom", ModuleIds: []string{"m1"}, Reachable: boolPtr(true), Anticipating: boolPtr(false), OpenWindow: boolPtr(false), MeasuredTemperature: floatPtr(20.5), SetPointTemperature: floatPtr(19), SetPointStartTime: uint64Ptr(1), SetPointEndTime: uint64Ptr(2), SetPointMode: stringPtr("schedule")},
+		},
+		{
+			name:   "name of homesdata is kept",
+			room:   Room{Id: "r1", Name: "Living"},
+			status: Room{Id: "r1", Name: "Other"},
+			want:   Room{Id: "r1", Name: "Living"},
+		},
+		{
+			name:   "missing name is filled in",
+			room:   Room{Id: "r1"},
+			status: Room{Id: "r1", Name: "Living"},
+			want:   Room{Id: "r1", Name: "Living"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.room
+			got.Merge(&tt.status)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", toJSON(t, got), toJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestModuleMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		module Module
+		status Module
+		want   Module
+	}{
+		{
+			name:   "explicit false and zero override homesdata",
+			module: Module{Id: "m1", Type: "NATherm1", Reachable: boolPtr(true), BoilerStatus: boolPtr(true), BatteryLevel: floatPtr(3000)},
+			status: Module{Id: "m1", Reachable: boolPtr(false), BoilerStatus: boolPtr(false), BatteryLevel: floatPtr(0), RfStrength: floatPtr(0)},
+			want:   Module{Id: "m1", Type: "NATherm1", Reachable: boolPtr(false), BoilerStatus: boolPtr(false), BatteryLevel: floatPtr(0), RfStrength: floatPtr(0)},
+		},
+		{
+			name:   "fields left out by homestatus stay nil",
+			module: Module{Id: "m1", Type: "NAPlug", FirmwareRevision: floatPtr(200), WifiStrength: floatPtr(50)},
+			status: Module{Id: "m1", WifiStrength: floatPtr(60)},
+			want:   Module{Id: "m1", Type: "NAPlug", WifiStrength: floatPtr(60)},
+		},
+		{
+			name:   "topology of homesdata is kept",
+			module: Module{Id: "m1", Name: "Thermostat", Type: "NATherm1", Bridge: "b1", RoomId: "r1"},
+			status: Module{Id: "m1", Name: "Other", Type: "NRV", Bridge: "b2", RoomId: "r2", Reachable: boolPtr(true)},
+			want:   Module{Id: "m1", Name: "Thermostat", Type: "NATherm1", Bridge: "b1", RoomId: "r1", Reachable: boolPtr(true)},
+		},
+		{
+			name:   "missing topology is filled in",
+			module: Module{Id: "m1"},
+			status: Module{Id: "m1", Name: "Thermostat", Type: "NATherm1", Bridge: "b1", RoomId: "r1"},
+			want:   Module{Id: "m1", Name: "Thermostat", Type: "NATherm1", Bridge: "b1", RoomId: "r1"},
+		},
+		{
+			name:   "all dynamic fields are taken over",
+			module: Module{Id: "m1", Type: "BNLD", ModulesBridged: []string{"m2"}},
+			status: Module{Id: "m1", Reachable: boolPtr(true), Anticipating: boolPtr(false), FirmwareRevision: floatPtr(1), RfStrength: floatPtr(2), WifiStrength: floatPtr(3), BatteryLevel: floatPtr(4), BatteryState: stringPtr("full"), BoilerStatus: boolPtr(false), Power: floatPtr(0), On: boolPtr(false), Brightness: floatPtr(0)},
+			want:   Module{Id: "m1", Type: "BNLD", ModulesBridged: []string{"m2"}, Reachable: boolPtr(true), Anticipating: boolPtr(false), FirmwareRevision: floatPtr(1), RfStrength: floatPtr(2), WifiStrength: floatPtr(3), BatteryLevel: floatPtr(4), BatteryState: stringPtr("full"), BoilerStatus: boolPtr(false), Power: floatPtr(0), On: boolPtr(false), Brightness: floatPtr(0)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.module
+			got.Merge(&tt.status)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", toJSON(t, got), toJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestHomeMerge(t *testing.T) {
+	tests := []struct {
+		name   string
+		home   Home
+		status Home
+		want   Home
+	}{
+		{
+			name:   "topology of homesdata is kept",
+			home:   Home{Id: "h1", Name: "Home", Country: "FR", Altitude: 35, Coordinates: []float64{2.3, 48.8}},
+			status: Home{Id: "h1", Name: "Other", Country: "DE", Altitude: 500, Coordinates: []float64{13.4, 52.5}},
+			want:   Home{Id: "h1", Name: "Home", Country: "FR", Altitude: 35, Coordinates: []float64{2.3, 48.8}},
+		},
+		{
+			name:   "missing topology is filled in",
+			home:   Home{Id: "h1"},
+			status: Home{Id: "h1", Name: "Home", Country: "FR", Altitude: 35, Coordinates: []float64{2.3, 48.8}},
+			want:   Home{Id: "h1", Name: "Home", Country: "FR", Altitude: 35, Coordinates: []float64{2.3, 48.8}},
+		},
+		{
+			name: "rooms and modules are merged by id",
+			home: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r1", Name: "Living"}, {Id: "r2", Name: "Bedroom"}},
+				Modules: []*Module{{Id: "m1", Type: "NAPlug"}, {Id: "m2", Type: "NATherm1", RoomId: "r1"}},
+			},
+			status: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r2", Reachable: boolPtr(false)}, {Id: "r1", Reachable: boolPtr(true), MeasuredTemperature: floatPtr(21)}},
+				Modules: []*Module{{Id: "m2", Reachable: boolPtr(true), BoilerStatus: boolPtr(false)}, {Id: "m1", WifiStrength: floatPtr(60)}},
+			},
+			want: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r1", Name: "Living", Reachable: boolPtr(true), MeasuredTemperature: floatPtr(21)}, {Id: "r2", Name: "Bedroom", Reachable: boolPtr(false)}},
+				Modules: []*Module{{Id: "m1", Type: "NAPlug", WifiStrength: floatPtr(60)}, {Id: "m2", Type: "NATherm1", RoomId: "r1", Reachable: boolPtr(true), BoilerStatus: boolPtr(false)}},
+			},
+		},
+		{
+			name: "rooms and modules missing in homestatus are kept as in homesdata",
+			home: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r1", Name: "Living", Reachable: boolPtr(true)}},
+				Modules: []*Module{{Id: "m1", Type: "NRV", Reachable: boolPtr(true)}},
+			},
+			status: Home{Id: "h1"},
+			want: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r1", Name: "Living", Reachable: boolPtr(true)}},
+				Modules: []*Module{{Id: "m1", Type: "NRV", Reachable: boolPtr(true)}},
+			},
+		},
+		{
+			name: "rooms and modules only known to homestatus are appended in its order",
+			home: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r1", Name: "Living"}},
+				Modules: []*Module{{Id: "m1", Type: "NAPlug"}},
+			},
+			status: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r9", Reachable: boolPtr(true)}, {Id: "r1"}, {Id: "r3"}, {Id: "r5"}},
+				Modules: []*Module{{Id: "m9", Type: "NRV"}, {Id: "m3", Type: "NRV"}, {Id: "m1"}, {Id: "m5", Type: "NRV"}},
+			},
+			want: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r1", Name: "Living"}, {Id: "r9", Reachable: boolPtr(true)}, {Id: "r3"}, {Id: "r5"}},
+				Modules: []*Module{{Id: "m1", Type: "NAPlug"}, {Id: "m9", Type: "NRV"}, {Id: "m3", Type: "NRV"}, {Id: "m5", Type: "NRV"}},
+			},
+		},
+		{
+			name: "homesdata without rooms and modules takes those of homestatus",
+			home: Home{Id: "h1", Name: "Home"},
+			status: Home{
+				Id:      "h1",
+				Rooms:   []*Room{{Id: "r2"}, {Id: "r1"}},
+				Modules: []*Module{{Id: "m2"}, {Id: "m1"}},
+			},
+			want: Home{
+				Id:      "h1",
+				Name:    "Home",
+				Rooms:   []*Room{{Id: "r2"}, {Id: "r1"}},
+				Modules: []*Module{{Id: "m2"}, {Id: "m1"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.home
+			got.Merge(&tt.status)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %s, want %s", toJSON(t, got), toJSON(t, tt.want))
+			}
+		})
+	}
+}
+
+func TestHomeMergeIsStable(t *testing.T) {
+	// Merging must not depend on map iteration order, so repeated merges
+	// of the same input have to give the same order every time.
+	var first string
+	for i := 0; i < 50; i++ {
+		home := Home{
+			Id:      "h1",
+			Rooms:   []*Room{{Id: "r1"}, {Id: "r2"}, {Id: "r3"}},
+			Modules: []*Module{{Id: "m1"}, {Id: "m2"}, {Id: "m3"}},
+		}
+		status := Home{
+			Id:      "h1",
+			Rooms:   []*Room{{Id: "r3"}, {Id: "r6"}, {Id: "r5"}, {Id: "r4"}, {Id: "r1"}},
+			Modules: []*Module{{Id: "m6"}, {Id: "m2"}, {Id: "m5"}, {Id: "m4"}},
+		}
+		home.Merge(&status)
+
+		got := toJSON(t, home)
+		if i == 0 {
+			first = got
+		} else if got != first {
+			t.Fatalf("merge %d gave %s, the first %s", i, got, first)
+		}
+	}
+}
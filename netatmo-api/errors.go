@@ -0,0 +1,136 @@
+package netatmo_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Error codes of the Netatmo API.
+const (
+	codeInvalidAccessToken      = 2
+	codeAccessTokenExpired      = 3
+	codeUserUsageReached        = 26
+	codeApplicationUsageReached = 33
+)
+
+// Error codes homestatus reports for modules.
+const (
+	ModuleErrorUnknown              = 1
+	ModuleErrorInternal             = 2
+	ModuleErrorParser               = 3
+	ModuleErrorCommandUnknown       = 4
+	ModuleErrorCommandInvalidParams = 5
+	ModuleErrorDeviceUnreachable    = 6
+	ModuleErrorCommand              = 7
+	ModuleErrorBatteryLevel         = 8
+	ModuleErrorBusy                 = 14
+	ModuleErrorModuleUnreachable    = 19
+	ModuleErrorNothingToModify      = 23
+	ModuleErrorTemporarilyBanned    = 27
+)
+
+var moduleErrorDescriptions = map[int]string{
+	ModuleErrorUnknown:              "unknown error",
+	ModuleErrorInternal:             "internal error",
+	ModuleErrorParser:               "parser error",
+	ModuleErrorCommandUnknown:       "unknown command",
+	ModuleErrorCommandInvalidParams: "invalid command parameters",
+	ModuleErrorDeviceUnreachable:    "device unreachable",
+	ModuleErrorCommand:              "command error",
+	ModuleErrorBatteryLevel:         "battery low",
+	ModuleErrorBusy:                 "busy",
+	ModuleErrorModuleUnreachable:    "module unreachable",
+	ModuleErrorNothingToModify:      "nothing to modify",
+	ModuleErrorTemporarilyBanned:    "temporarily banned",
+}
+
+// ModuleError is an error homestatus reports for a module of a home.
+type ModuleError struct {
+	Code int    `json:"code"`
+	Id   string `json:"id"`
+}
+
+// Description returns a human readable description of the error code.
+func (e *ModuleError) Description() string {
+	if d, ok := moduleErrorDescriptions[e.Code]; ok {
+		return d
+	}
+	return "unknown error code"
+}
+
+// maxErrorBody is how much of a response body an APIError message includes.
+const maxErrorBody = 256
+
+// ErrRateLimited is matched by errors of requests Netatmo rejected because
+// the user or application exceeded its request quota.
+var ErrRateLimited = errors.New("rate limited")
+
+// ErrInvalidToken is matched by errors of requests Netatmo rejected because
+// the access token is invalid, revoked or expired.
+var ErrInvalidToken = errors.New("invalid access token")
+
+// ErrNeedsReauth is returned when the token could not be refreshed and the
+// client has to be authorized again, e.g. with the login command.
+var ErrNeedsReauth = errors.New("needs re-authentication")
+
+// APIError is returned for requests the API did not answer with 200 OK.
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	Body       string
+}
+
+func newAPIError(statusCode int, body string) *APIError {
+	e := &APIError{
+		StatusCode: statusCode,
+		Body:       body,
+	}
+
+	var v struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &v); err == nil {
+		e.Code = v.Error.Code
+		e.Message = v.Error.Message
+	}
+
+	return e
+}
+
+// Error reports the error code and message of the API. Only if the API did
+// not send them, the start of the body is included, with secrets redacted.
+// Redacting comes first, as a cut through a secret would hide it from
+// Redact.
+func (e *APIError) Error() string {
+	if e.Code != 0 || e.Message != "" {
+		return fmt.Sprintf("invalid request: status_code = %d code = %d message = %s", e.StatusCode, e.Code, Redact(e.Message))
+	}
+
+	body := Redact(e.Body)
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody] + "..."
+	}
+	return fmt.Sprintf("invalid request: status_code = %d content=%v", e.StatusCode, body)
+}
+
+// Is makes errors.Is(err, ErrRateLimited) and errors.Is(err,
+// ErrInvalidToken) work for API errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests ||
+			e.Code == codeUserUsageReached ||
+			e.Code == codeApplicationUsageReached
+	case ErrInvalidToken:
+		return e.Code == codeInvalidAccessToken ||
+			e.Code == codeAccessTokenExpired
+	default:
+		return false
+	}
+}
@@ -0,0 +1,27 @@
+package netatmo_api
+
+// HomeCoachsData is the body of the gethomecoachsdata endpoint.
+type HomeCoachsData struct {
+	Devices []*HomeCoach `json:"devices"`
+}
+
+// HomeCoach is a Healthy Home Coach (NHC) device.
+type HomeCoach struct {
+	Id            string         `json:"_id"`
+	Name          string         `json:"name"`
+	StationName   string         `json:"station_name"`
+	Type          string         `json:"type"`
+	HomeId        string         `json:"home_id"`
+	HomeName      string         `json:"home_name"`
+	Firmware      *float64       `json:"firmware"`
+	WifiStatus    *float64       `json:"wifi_status"`
+	Reachable     *bool          `json:"reachable"`
+	DataType      []string       `json:"data_type"`
+	Place         *Place         `json:"place"`
+	DashboardData *DashboardData `json:"dashboard_data"`
+}
+
+// IsReachable reports whether the device is known to be reachable.
+func (h *HomeCoach) IsReachable() bool {
+	return h.Reachable != nil && *h.Reachable
+}
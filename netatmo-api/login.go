@@ -0,0 +1,105 @@
+package netatmo_api
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrStateMismatch is returned by AuthorizationRequest.Exchange when the
+// callback does not belong to the request.
+var ErrStateMismatch = errors.New("state of the callback does not match the request")
+
+// AuthorizationRequest runs the authorization code flow with PKCE: the
+// user opens URL in a browser, grants access and is redirected to the
+// redirect URL with a code, which Exchange turns into a token.
+type AuthorizationRequest struct {
+	oauth    *oauth2.Config
+	state    string
+	verifier string
+}
+
+// NewAuthorizationRequest starts the authorization of the client configured
+// in cnf for cnf.Scopes. Netatmo redirects to redirectURL afterwards.
+func NewAuthorizationRequest(cnf *Config, redirectURL string) (*AuthorizationRequest, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthorizationRequest{
+		oauth: &oauth2.Config{
+			ClientID:     cnf.ClientID,
+			ClientSecret: cnf.ClientSecret,
+			Scopes:       cnf.Scopes,
+			RedirectURL:  redirectURL,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  authURL,
+				TokenURL: tokenURL,
+			},
+		},
+		state:    state,
+		verifier: verifier,
+	}, nil
+}
+
+// URL returns the address the user has to open to grant access.
+func (r *AuthorizationRequest) URL() string {
+	challenge := sha256.Sum256([]byte(r.verifier))
+	return r.oauth.AuthCodeURL(
+		r.state,
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+// CheckState returns ErrStateMismatch if a callback with the given state
+// does not belong to the request. Callbacks have to be checked before
+// anything else of them is trusted, also those telling that access was
+// not granted.
+func (r *AuthorizationRequest) CheckState(state string) error {
+	if state != r.state {
+		return ErrStateMismatch
+	}
+	return nil
+}
+
+// Exchange validates the state the callback was called with and exchanges
+// its code for a token.
+func (r *AuthorizationRequest) Exchange(ctx context.Context, state string, code string) (*StoredToken, error) {
+	if err := r.CheckState(state); err != nil {
+		return nil, err
+	}
+
+	token, err := r.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", r.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("could not exchange code: %w", err)
+	}
+
+	return &StoredToken{
+		Token:      token,
+		Scopes:     grantedScopes(token),
+		ObtainedAt: time.Now(),
+	}, nil
+}
+
+// randomString returns 32 random bytes, URL safe encoded as required for
+// state and PKCE verifier.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
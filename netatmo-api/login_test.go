@@ -0,0 +1,36 @@
+package netatmo_api
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAuthorizationRequestState(t *testing.T) {
+	r, err := NewAuthorizationRequest(&Config{ClientID: "client", ClientSecret: "secret"}, "http://localhost/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		state string
+		want  error
+	}{
+		{"request", r.state, nil},
+		{"other request", "other", ErrStateMismatch},
+		{"no state", "", ErrStateMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := r.CheckState(tt.state); !errors.Is(err, tt.want) {
+				t.Errorf("CheckState(%q) = %v, want %v", tt.state, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := r.Exchange(context.Background(), "other", "code"); !errors.Is(err, ErrStateMismatch) {
+		t.Errorf("Exchange with another state = %v, want ErrStateMismatch", err)
+	}
+}
@@ -0,0 +1,170 @@
+package netatmo_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory is an API serving data held in memory, e.g. to test collectors
+// or to feed them from another data source. Every call returns a copy, so
+// callers may modify the result. The zero value has no data; homes,
+// stations and home coachs which are not set are returned empty, unknown
+// home statuses as an error.
+type Memory struct {
+	mu             sync.RWMutex
+	homesData      *HomesData
+	homeStatuses   map[string]*HomeStatus
+	measures       map[string][]*ModuleMeasurePoint
+	stationsData   *StationsData
+	homeCoachsData *HomeCoachsData
+}
+
+var _ API = (*Memory)(nil)
+
+// SetHomesData sets the body returned by GetHomesData.
+func (m *Memory) SetHomesData(v *HomesData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.homesData = v
+}
+
+// SetHomeStatus sets the body returned by GetHomeStatus for the given home.
+func (m *Memory) SetHomeStatus(home string, v *HomeStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.homeStatuses == nil {
+		m.homeStatuses = make(map[string]*HomeStatus)
+	}
+	m.homeStatuses[home] = v
+}
+
+// AddMeasures adds measure points of the given module to those returned by
+// GetMeasure.
+func (m *Memory) AddMeasures(module string, points ...*ModuleMeasurePoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.measures == nil {
+		m.measures = make(map[string][]*ModuleMeasurePoint)
+	}
+	m.measures[module] = append(m.measures[module], points...)
+}
+
+// SetStationsData sets the body returned by GetStationsData.
+func (m *Memory) SetStationsData(v *StationsData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stationsData = v
+}
+
+// SetHomeCoachsData sets the body returned by GetHomeCoachsData.
+func (m *Memory) SetHomeCoachsData(v *HomeCoachsData) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.homeCoachsData = v
+}
+
+func (m *Memory) GetHomesData() (*HomesData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var v HomesData
+	if m.homesData != nil {
+		if err := deepCopy(m.homesData, &v); err != nil {
+			return nil, err
+		}
+	}
+	return &v, nil
+}
+
+func (m *Memory) GetHomeStatus(home string) (*HomeStatus, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.homeStatuses[home]
+	if !ok {
+		return nil, fmt.Errorf("no status of home %s", home)
+	}
+
+	var v HomeStatus
+	if err := deepCopy(s, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (m *Memory) GetHomes() (*Homes, error) {
+	homesData, err := m.GetHomesData()
+	if err != nil {
+		return nil, err
+	}
+
+	return mergeHomeStatuses(homesData, 1, m.GetHomeStatus), nil
+}
+
+// GetMeasure returns the added points of module mod between from and
+// until, limited to the requested types.
+func (m *Memory) GetMeasure(mod *Module, types []string, from time.Time, until time.Time) (*ModuleMeasures, error) {
+	if len(types) == 0 {
+		return nil, errors.New("at least one measure type has to be there")
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	measures := &ModuleMeasures{}
+	for _, p := range m.measures[mod.Id] {
+		if p.Time < from.Unix() || p.Time > until.Unix() {
+			continue
+		}
+
+		mp := &ModuleMeasurePoint{
+			Time:   p.Time,
+			Values: make(map[string]float64),
+		}
+		for _, t := range types {
+			if v, ok := p.Values[t]; ok {
+				mp.Values[t] = v
+			}
+		}
+		measures.Measures = append(measures.Measures, mp)
+	}
+	return measures, nil
+}
+
+func (m *Memory) GetStationsData() (*StationsData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var v StationsData
+	if m.stationsData != nil {
+		if err := deepCopy(m.stationsData, &v); err != nil {
+			return nil, err
+		}
+	}
+	return &v, nil
+}
+
+func (m *Memory) GetHomeCoachsData() (*HomeCoachsData, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var v HomeCoachsData
+	if m.homeCoachsData != nil {
+		if err := deepCopy(m.homeCoachsData, &v); err != nil {
+			return nil, err
+		}
+	}
+	return &v, nil
+}
+
+// deepCopy copies src into dst the same way the API bodies are decoded.
+func deepCopy(src interface{}, dst interface{}) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return fmt.Errorf("could not copy: %w", err)
+	}
+	return json.Unmarshal(b, dst)
+}
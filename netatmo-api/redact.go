@@ -0,0 +1,61 @@
+package netatmo_api
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretNames are the names secrets are sent and received as, e.g. in
+// token responses or the parameters of the token endpoint.
+const secretNames = `access_token|refresh_token|client_secret|password|code_verifier|code`
+
+var secretPatterns = []*regexp.Regexp{
+	// JSON, e.g. a token response, also when it was cut off within the
+	// value
+	regexp.MustCompile(`("(?:` + secretNames + `)"\s*:\s*")[^"]*("|$)`),
+	// query strings and form bodies
+	regexp.MustCompile(`(\b(?:` + secretNames + `)=)()[^&\s"]+`),
+	// authorization headers
+	regexp.MustCompile(`(Bearer\s+)()[A-Za-z0-9._~+/|=-]+`),
+}
+
+// Redact replaces tokens, secrets and passwords in s, e.g. in the body of a
+// response, by a placeholder.
+func Redact(s string) string {
+	for _, p := range secretPatterns {
+		s = p.ReplaceAllString(s, "${1}"+redacted+"${2}")
+	}
+	return s
+}
+
+// RedactAttr can be used as slog.HandlerOptions.ReplaceAttr: it drops the
+// values of attributes named like secrets and redacts all string and error
+// values, including the message.
+func RedactAttr(_ []string, a slog.Attr) slog.Attr {
+	if isSecretName(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+	}
+	return a
+}
+
+func isSecretName(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "token", "access_token", "refresh_token", "authorization", "code_verifier":
+		return true
+	default:
+		return strings.Contains(key, "secret") || strings.Contains(key, "password")
+	}
+}
@@ -0,0 +1,129 @@
+package netatmo_api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "token response",
+			in:   `{"access_token":"at-secret","refresh_token":"rt-secret","expires_in":10800,"scope":["read_thermostat"]}`,
+			want: `{"access_token":"[REDACTED]","refresh_token":"[REDACTED]","expires_in":10800,"scope":["read_thermostat"]}`,
+		},
+		{
+			name: "JSON with spaces",
+			in:   `{ "access_token" : "at-secret" }`,
+			want: `{ "access_token" : "[REDACTED]" }`,
+		},
+		{
+			name: "JSON cut off within the value",
+			in:   `{"error":"x","access_token":"abcdefgh`,
+			want: `{"error":"x","access_token":"[REDACTED]`,
+		},
+		{
+			name: "form body",
+			in:   `grant_type=refresh_token&refresh_token=rt-secret&client_id=id&client_secret=cs-secret`,
+			want: `grant_type=refresh_token&refresh_token=[REDACTED]&client_id=id&client_secret=[REDACTED]`,
+		},
+		{
+			name: "query string",
+			in:   `https://example.com/callback?state=abc&code=auth-code`,
+			want: `https://example.com/callback?state=abc&code=[REDACTED]`,
+		},
+		{
+			name: "password grant",
+			in:   `username=me%40example.com&password=hunter2`,
+			want: `username=me%40example.com&password=[REDACTED]`,
+		},
+		{
+			name: "PKCE verifier",
+			in:   `code_verifier=verifier-secret&code=auth-code`,
+			want: `code_verifier=[REDACTED]&code=[REDACTED]`,
+		},
+		{
+			name: "authorization header",
+			in:   `Authorization: Bearer 5f3c|a1b2c3.d4-e5_f6~`,
+			want: `Authorization: Bearer [REDACTED]`,
+		},
+		{
+			name: "names containing a secret name",
+			in:   `error_code=5&status_code=403`,
+			want: `error_code=5&status_code=403`,
+		},
+		{
+			name: "API error",
+			in:   `{"error":{"code":3,"message":"Access token expired"}}`,
+			want: `{"error":{"code":3,"message":"Access token expired"}}`,
+		},
+		{
+			name: "nothing to redact",
+			in:   `could not get data: context deadline exceeded`,
+			want: `could not get data: context deadline exceeded`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: RedactAttr}))
+
+	logger.Info("got access_token=msg-secret",
+		"client_secret", "cs-secret",
+		"Password", "pw-secret",
+		"token", "tok-secret",
+		"refresh_token", "rt-secret",
+		"authorization", "Bearer hdr-secret",
+		"url", "https://example.com/?code=code-secret",
+		"err", fmt.Errorf("refresh failed: %w", errors.New(`{"refresh_token":"err-secret"}`)),
+		slog.Group("request", "body", `{"access_token":"grp-secret"}`),
+		"home_id", "home-1",
+		"duration", 42,
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"msg-secret", "cs-secret", "pw-secret", "tok-secret", "rt-secret", "hdr-secret", "code-secret", "err-secret", "grp-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %s: %s", secret, out)
+		}
+	}
+	for _, kept := range []string{"home_id=home-1", "duration=42", "refresh failed"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("log lacks %s: %s", kept, out)
+		}
+	}
+}
+
+func TestAPIErrorRedactsBeforeTruncating(t *testing.T) {
+	// the cut at maxErrorBody lands within the access token
+	prefix := `{"padding":"` + strings.Repeat("x", maxErrorBody-40) + `",`
+	body := prefix + `"access_token":"` + strings.Repeat("s", 64) + `"}`
+
+	msg := newAPIError(500, body).Error()
+	if strings.Contains(msg, "ssss") {
+		t.Errorf("error message contains the token: %s", msg)
+	}
+	if !strings.Contains(msg, "[REDACTED]") {
+		t.Errorf("error message lacks the placeholder: %s", msg)
+	}
+	if !strings.HasSuffix(msg, "...") {
+		t.Errorf("error message was not truncated: %s", msg)
+	}
+}
@@ -0,0 +1,196 @@
+package netatmo_api
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+
+	scheduleTypeTherm = "therm"
+
+	ThermModeSchedule   = "schedule"
+	ThermModeAway       = "away"
+	ThermModeFrostGuard = "hg"
+
+	SetPointModeManual = "manual"
+	SetPointModeMax    = "max"
+	SetPointModeHome   = "home"
+)
+
+// ThermostatSchedules returns all heating schedules of the home. Depending
+// on the API version homesdata reports them as therm_schedules or as
+// schedules of type therm.
+func (h *Home) ThermostatSchedules() []*Schedule {
+	schedules := append([]*Schedule{}, h.ThermSchedules...)
+	for _, s := range h.Schedules {
+		if s.Type == "" || s.Type == scheduleTypeTherm {
+			schedules = append(schedules, s)
+		}
+	}
+	return schedules
+}
+
+// ActiveSchedule returns the selected heating schedule of the home or nil
+// if there is none.
+func (h *Home) ActiveSchedule() *Schedule {
+	for _, s := range h.ThermostatSchedules() {
+		if s.Selected {
+			return s
+		}
+	}
+	return nil
+}
+
+// Location returns the timezone of the home. UTC is used if the home has
+// no timezone or it is unknown.
+func (h *Home) Location() *time.Location {
+	if h.Timezone == "" {
+		return time.UTC
+	}
+
+	loc, err := time.LoadLocation(h.Timezone)
+	if err != nil {
+		slog.Warn("Unknown timezone of home, using UTC", "home_id", h.Id, "timezone", h.Timezone, "err", err)
+		return time.UTC
+	}
+	return loc
+}
+
+// ScheduledSetPoint returns the temperature the given room should have at t
+// according to the therm mode and the active schedule of the home, i.e.
+// without manual overrides. In away and frost guard mode that is the
+// respective temperature of the schedule, otherwise the temperature of the
+// room in the zone the schedule is in at t.
+func (h *Home) ScheduledSetPoint(roomId string, t time.Time) (float64, bool) {
+	schedule := h.ActiveSchedule()
+	if schedule == nil {
+		return 0, false
+	}
+
+	switch h.ThermMode {
+	case ThermModeAway:
+		if schedule.AwayTemp != nil {
+			return *schedule.AwayTemp, true
+		}
+		return 0, false
+	case ThermModeFrostGuard:
+		if schedule.HgTemp != nil {
+			return *schedule.HgTemp, true
+		}
+		return 0, false
+	}
+
+	zone := schedule.ZoneAt(t.In(h.Location()))
+	if zone == nil {
+		return 0, false
+	}
+	return zone.RoomTemperature(roomId)
+}
+
+// Zone returns the zone with the given id or nil if there is none.
+func (s *Schedule) Zone(id int) *Zone {
+	for _, z := range s.Zones {
+		if z.Id == id {
+			return z
+		}
+	}
+	return nil
+}
+
+// ZoneAt returns the zone the schedule is in at t. t has to be in the
+// location of the home the schedule belongs to.
+func (s *Schedule) ZoneAt(t time.Time) *Zone {
+	e := s.entryAt(weekOffset(t))
+	if e == nil {
+		return nil
+	}
+	return s.Zone(e.ZoneId)
+}
+
+// NextChange returns the time after t at which the schedule switches to
+// another zone and that zone. t has to be in the location of the home the
+// schedule belongs to. The offsets of the timetable are wall clock times,
+// so across daylight saving time transitions the returned time is still at
+// the wall clock time the timetable asks for.
+func (s *Schedule) NextChange(t time.Time) (time.Time, *Zone, bool) {
+	offset := weekOffset(t)
+	current := s.entryAt(offset)
+	if current == nil {
+		return time.Time{}, nil, false
+	}
+
+	entries := append([]*TimetableEntry{}, s.Timetable...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].MOffset < entries[j].MOffset
+	})
+
+	// the rest of this week and the whole next week cover every change
+	for week := 0; week < 2; week++ {
+		for _, e := range entries {
+			o := week*minutesPerWeek + e.MOffset
+			if o <= offset || e.ZoneId == current.ZoneId {
+				continue
+			}
+			return atWeekOffset(t, o), s.Zone(e.ZoneId), true
+		}
+	}
+	return time.Time{}, nil, false
+}
+
+// entryAt returns the timetable entry active at the given week offset. The
+// timetable wraps around the week, so before the first entry of the week
+// the last entry of the previous week is still active.
+func (s *Schedule) entryAt(offset int) *TimetableEntry {
+	var active, last *TimetableEntry
+	for _, e := range s.Timetable {
+		if e.MOffset <= offset && (active == nil || e.MOffset >= active.MOffset) {
+			active = e
+		}
+		if last == nil || e.MOffset >= last.MOffset {
+			last = e
+		}
+	}
+
+	if active == nil {
+		return last
+	}
+	return active
+}
+
+// RoomTemperature returns the target temperature of the given room within
+// the zone.
+func (z *Zone) RoomTemperature(roomId string) (float64, bool) {
+	for _, r := range z.Rooms {
+		if r.Id == roomId {
+			return r.SetPointTemperature, true
+		}
+	}
+	return 0, false
+}
+
+// atWeekOffset returns the time at the given offset in minutes after Monday
+// 00:00 of t's week, on the wall clock of t's location.
+func atWeekOffset(t time.Time, offset int) time.Time {
+	weekday := (int(t.Weekday()) + 6) % 7
+	return time.Date(
+		t.Year(),
+		t.Month(),
+		t.Day()-weekday+offset/minutesPerDay,
+		(offset%minutesPerDay)/60,
+		offset%60,
+		0,
+		0,
+		t.Location(),
+	)
+}
+
+// weekOffset returns the minutes since Monday 00:00 of t's week on the wall
+// clock of t's location, which is how Netatmo encodes timetable offsets.
+func weekOffset(t time.Time) int {
+	weekday := (int(t.Weekday()) + 6) % 7
+	return weekday*minutesPerDay + t.Hour()*60 + t.Minute()
+}
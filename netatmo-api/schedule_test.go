@@ -0,0 +1,247 @@
+package netatmo_api
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+const (
+	zoneComfort = 0
+	zoneNight   = 1
+	zoneEco     = 4
+)
+
+// weekMinute returns the timetable offset of the given wall clock time,
+// day 0 being Monday.
+func weekMinute(day, hour, minute int) int {
+	return day*minutesPerDay + hour*60 + minute
+}
+
+func testSchedule(entries ...*TimetableEntry) *Schedule {
+	return &Schedule{
+		Id:        "s1",
+		Timetable: entries,
+		Zones: []*Zone{
+			{Id: zoneComfort, Name: "Comfort"},
+			{Id: zoneNight, Name: "Night"},
+			{Id: zoneEco, Name: "Eco"},
+		},
+	}
+}
+
+// dailySchedule is comfort from 06:00 to 22:00 and night otherwise, with
+// the first entry of the week after Monday 00:00.
+func dailySchedule() *Schedule {
+	var entries []*TimetableEntry
+	for day := 0; day < 7; day++ {
+		entries = append(entries,
+			&TimetableEntry{ZoneId: zoneComfort, MOffset: weekMinute(day, 6, 0)},
+			&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(day, 22, 0)},
+		)
+	}
+	return testSchedule(entries...)
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestWeekOffset(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want int
+	}{
+		{"monday midnight", time.Date(2024, 3, 25, 0, 0, 0, 0, paris), 0},
+		{"sunday before midnight", time.Date(2024, 3, 31, 23, 59, 0, 0, paris), weekMinute(6, 23, 59)},
+		{"after spring forward", time.Date(2024, 3, 31, 3, 0, 0, 0, paris), weekMinute(6, 3, 0)},
+		{"first 02:30 of fall back", time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC).In(paris), weekMinute(6, 2, 30)},
+		{"second 02:30 of fall back", time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC).In(paris), weekMinute(6, 2, 30)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := weekOffset(tt.t); got != tt.want {
+				t.Errorf("weekOffset(%v) = %d, want %d", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAtWeekOffset(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name   string
+		t      time.Time
+		offset int
+		want   time.Time
+	}{
+		{"same week", time.Date(2024, 3, 27, 12, 0, 0, 0, paris), weekMinute(4, 18, 30), time.Date(2024, 3, 29, 18, 30, 0, 0, paris)},
+		{"following week", time.Date(2024, 3, 31, 23, 0, 0, 0, paris), minutesPerWeek + weekMinute(0, 6, 0), time.Date(2024, 4, 1, 6, 0, 0, 0, paris)},
+		{"across month and year", time.Date(2024, 12, 31, 8, 0, 0, 0, paris), minutesPerWeek + weekMinute(0, 0, 0), time.Date(2025, 1, 6, 0, 0, 0, 0, paris)},
+		{"after spring forward", time.Date(2024, 3, 30, 23, 0, 0, 0, paris), weekMinute(6, 7, 0), time.Date(2024, 3, 31, 5, 0, 0, 0, time.UTC)},
+		{"after fall back", time.Date(2024, 10, 27, 1, 0, 0, 0, paris), weekMinute(6, 7, 0), time.Date(2024, 10, 27, 6, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := atWeekOffset(tt.t, tt.offset); !got.Equal(tt.want) {
+				t.Errorf("atWeekOffset(%v, %d) = %v, want %v", tt.t, tt.offset, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleZoneAt(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		t        time.Time
+		want     int
+	}{
+		{"after an entry", dailySchedule(), time.Date(2024, 3, 27, 12, 0, 0, 0, paris), zoneComfort},
+		{"at an entry", dailySchedule(), time.Date(2024, 3, 27, 22, 0, 0, 0, paris), zoneNight},
+		{"wraps around before the first entry", dailySchedule(), time.Date(2024, 3, 25, 0, 30, 0, 0, paris), zoneNight},
+		{
+			name: "wraps around to the last entry of the week",
+			schedule: testSchedule(
+				&TimetableEntry{ZoneId: zoneComfort, MOffset: weekMinute(0, 6, 0)},
+				&TimetableEntry{ZoneId: zoneEco, MOffset: weekMinute(6, 20, 0)},
+				&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(2, 22, 0)},
+			),
+			t:    time.Date(2024, 3, 25, 5, 59, 0, 0, paris),
+			want: zoneEco,
+		},
+		{"before the entry on spring forward", dailySchedule(), time.Date(2024, 3, 31, 5, 59, 0, 0, paris), zoneNight},
+		{"at the entry on spring forward", dailySchedule(), time.Date(2024, 3, 31, 6, 0, 0, 0, paris), zoneComfort},
+		{"at the entry on fall back", dailySchedule(), time.Date(2024, 10, 27, 6, 0, 0, 0, paris), zoneComfort},
+		{
+			name:     "in the repeated hour of fall back",
+			schedule: testSchedule(&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(0, 0, 0)}, &TimetableEntry{ZoneId: zoneEco, MOffset: weekMinute(6, 2, 30)}),
+			t:        time.Date(2024, 10, 27, 1, 45, 0, 0, time.UTC).In(paris),
+			want:     zoneEco,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := tt.schedule.ZoneAt(tt.t)
+			if zone == nil {
+				t.Fatalf("ZoneAt(%v) = nil, want zone %d", tt.t, tt.want)
+			}
+			if zone.Id != tt.want {
+				t.Errorf("ZoneAt(%v) = zone %d, want zone %d", tt.t, zone.Id, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleZoneAtWithoutTimetable(t *testing.T) {
+	if zone := testSchedule().ZoneAt(time.Now()); zone != nil {
+		t.Errorf("ZoneAt = zone %d, want nil", zone.Id)
+	}
+}
+
+func TestScheduleNextChange(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		t        time.Time
+		want     time.Time
+		wantZone int
+	}{
+		{"later the same day", dailySchedule(), time.Date(2024, 3, 27, 12, 0, 0, 0, paris), time.Date(2024, 3, 27, 22, 0, 0, 0, paris), zoneNight},
+		{"at an entry returns the next one", dailySchedule(), time.Date(2024, 3, 27, 6, 0, 0, 0, paris), time.Date(2024, 3, 27, 22, 0, 0, 0, paris), zoneNight},
+		{"the next day", dailySchedule(), time.Date(2024, 3, 27, 23, 0, 0, 0, paris), time.Date(2024, 3, 28, 6, 0, 0, 0, paris), zoneComfort},
+		{"in the following week", dailySchedule(), time.Date(2024, 3, 31, 23, 0, 0, 0, paris), time.Date(2024, 4, 1, 6, 0, 0, 0, paris), zoneComfort},
+		{
+			name: "skips entries repeating the current zone",
+			schedule: testSchedule(
+				&TimetableEntry{ZoneId: zoneComfort, MOffset: weekMinute(0, 6, 0)},
+				&TimetableEntry{ZoneId: zoneComfort, MOffset: weekMinute(0, 8, 0)},
+				&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(0, 22, 0)},
+			),
+			t:        time.Date(2024, 3, 25, 7, 0, 0, 0, paris),
+			want:     time.Date(2024, 3, 25, 22, 0, 0, 0, paris),
+			wantZone: zoneNight,
+		},
+		{
+			name: "skips repeated zones into the following week",
+			schedule: testSchedule(
+				&TimetableEntry{ZoneId: zoneComfort, MOffset: weekMinute(0, 6, 0)},
+				&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(5, 22, 0)},
+				&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(6, 22, 0)},
+			),
+			t:        time.Date(2024, 3, 30, 23, 0, 0, 0, paris),
+			want:     time.Date(2024, 4, 1, 6, 0, 0, 0, paris),
+			wantZone: zoneComfort,
+		},
+		{
+			name:     "unsorted timetable",
+			schedule: testSchedule(&TimetableEntry{ZoneId: zoneNight, MOffset: weekMinute(0, 22, 0)}, &TimetableEntry{ZoneId: zoneComfort, MOffset: weekMinute(0, 6, 0)}),
+			t:        time.Date(2024, 3, 25, 3, 0, 0, 0, paris),
+			want:     time.Date(2024, 3, 25, 6, 0, 0, 0, paris),
+			wantZone: zoneComfort,
+		},
+		// 2024-03-31 02:00 CET is 03:00 CEST: the night is an hour
+		// shorter, but 06:00 is still 06:00 on the wall clock.
+		{"across spring forward", dailySchedule(), time.Date(2024, 3, 30, 23, 0, 0, 0, paris), time.Date(2024, 3, 31, 4, 0, 0, 0, time.UTC), zoneComfort},
+		// 2024-10-27 03:00 CEST is 02:00 CET: the night is an hour longer.
+		{"across fall back", dailySchedule(), time.Date(2024, 10, 26, 23, 0, 0, 0, paris), time.Date(2024, 10, 27, 5, 0, 0, 0, time.UTC), zoneComfort},
+		{
+			name:     "from the repeated hour of fall back",
+			schedule: dailySchedule(),
+			t:        time.Date(2024, 10, 27, 1, 30, 0, 0, time.UTC).In(paris),
+			want:     time.Date(2024, 10, 27, 6, 0, 0, 0, paris),
+			wantZone: zoneComfort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, zone, ok := tt.schedule.NextChange(tt.t)
+			if !ok {
+				t.Fatalf("NextChange(%v) found no change, want %v", tt.t, tt.want)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextChange(%v) = %v, want %v", tt.t, got, tt.want.In(paris))
+			}
+			if zone == nil || zone.Id != tt.wantZone {
+				t.Errorf("NextChange(%v) switches to %+v, want zone %d", tt.t, zone, tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestScheduleNextChangeWithoutChange(t *testing.T) {
+	paris := mustLoadLocation(t, "Europe/Paris")
+
+	tests := []struct {
+		name     string
+		schedule *Schedule
+	}{
+		{"no timetable", testSchedule()},
+		{"a single zone", testSchedule(&TimetableEntry{ZoneId: zoneEco, MOffset: 0}, &TimetableEntry{ZoneId: zoneEco, MOffset: weekMinute(3, 12, 0)})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, zone, ok := tt.schedule.NextChange(time.Date(2024, 3, 27, 12, 0, 0, 0, paris)); ok {
+				t.Errorf("NextChange = %v, %+v, want no change", got, zone)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package netatmo_api
+
+// StationsData is the body of the getstationsdata endpoint.
+type StationsData struct {
+	Devices []*Station `json:"devices"`
+}
+
+// Station is a weather station main module (NAMain) with the modules
+// connected to it.
+type Station struct {
+	Id            string           `json:"_id"`
+	StationName   string           `json:"station_name"`
+	ModuleName    string           `json:"module_name"`
+	Type          string           `json:"type"`
+	HomeId        string           `json:"home_id"`
+	HomeName      string           `json:"home_name"`
+	Firmware      *float64         `json:"firmware"`
+	WifiStatus    *float64         `json:"wifi_status"`
+	Reachable     *bool            `json:"reachable"`
+	DataType      []string         `json:"data_type"`
+	Place         *Place           `json:"place"`
+	DashboardData *DashboardData   `json:"dashboard_data"`
+	Modules       []*StationModule `json:"modules"`
+}
+
+// StationModule is a module connected to a weather station, e.g. an
+// outdoor (NAModule1), wind (NAModule2), rain (NAModule3) or additional
+// indoor (NAModule4) module.
+type StationModule struct {
+	Id             string         `json:"_id"`
+	ModuleName     string         `json:"module_name"`
+	Type           string         `json:"type"`
+	Firmware       *float64       `json:"firmware"`
+	RfStatus       *float64       `json:"rf_status"`
+	BatteryPercent *float64       `json:"battery_percent"`
+	BatteryVp      *float64       `json:"battery_vp"`
+	Reachable      *bool          `json:"reachable"`
+	LastSeen       *int64         `json:"last_seen"`
+	DataType       []string       `json:"data_type"`
+	DashboardData  *DashboardData `json:"dashboard_data"`
+}
+
+// Place is the location of a weather station. Location holds longitude and
+// latitude like the coordinates of a Home.
+type Place struct {
+	Altitude uint32    `json:"altitude"`
+	City     string    `json:"city"`
+	Country  string    `json:"country"`
+	Timezone string    `json:"timezone"`
+	Location []float64 `json:"location"`
+}
+
+// DashboardData are the last measurements of a station or module. Only the
+// values the module measures are reported, all others are nil.
+type DashboardData struct {
+	TimeUTC          *int64   `json:"time_utc"`
+	Temperature      *float64 `json:"Temperature"`
+	Humidity         *float64 `json:"Humidity"`
+	CO2              *float64 `json:"CO2"`
+	Noise            *float64 `json:"Noise"`
+	Pressure         *float64 `json:"Pressure"`
+	AbsolutePressure *float64 `json:"AbsolutePressure"`
+	Rain             *float64 `json:"Rain"`
+	SumRain1         *float64 `json:"sum_rain_1"`
+	SumRain24        *float64 `json:"sum_rain_24"`
+	WindStrength     *float64 `json:"WindStrength"`
+	WindAngle        *float64 `json:"WindAngle"`
+	GustStrength     *float64 `json:"GustStrength"`
+	GustAngle        *float64 `json:"GustAngle"`
+	HealthIdx        *float64 `json:"health_idx"`
+}
+
+// IsReachable reports whether the station is known to be reachable.
+func (s *Station) IsReachable() bool {
+	return s.Reachable != nil && *s.Reachable
+}
+
+// IsReachable reports whether the module is known to be reachable.
+func (m *StationModule) IsReachable() bool {
+	return m.Reachable != nil && *m.Reachable
+}
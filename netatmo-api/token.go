@@ -0,0 +1,345 @@
+package netatmo_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by a TokenStore which does not hold a token yet.
+var ErrNoToken = errors.New("no token stored")
+
+// StoredToken is a token together with what is needed to tell later on
+// what it may be used for. Scopes are those the token endpoint reported as
+// granted, nil if it did not report them; the requested scopes are no
+// evidence of what was granted.
+type StoredToken struct {
+	Token      *oauth2.Token `json:"token"`
+	Scopes     []string      `json:"scopes"`
+	ObtainedAt time.Time     `json:"obtained_at"`
+}
+
+// TokenStore persists the token of a client. Netatmo rotates the refresh
+// token on every refresh, so the token has to be saved whenever it changes
+// to survive a restart.
+type TokenStore interface {
+	// Load returns the stored token or ErrNoToken.
+	Load() (*StoredToken, error)
+	// Save replaces the stored token.
+	Save(t *StoredToken) error
+}
+
+// TokenLocker is implemented by token stores shared between processes. The
+// lock is held while a token is refreshed and saved.
+type TokenLocker interface {
+	// Lock blocks until the lock is acquired and returns a function
+	// releasing it.
+	Lock() (unlock func(), err error)
+}
+
+// FileTokenStore stores the token as JSON in a file only readable by its
+// owner. The file may be shared between processes, e.g. on a common volume
+// of several exporter replicas: it is locked through a .lock file next to
+// it while the token is refreshed.
+type FileTokenStore struct {
+	path string
+	keys *TokenKeys
+}
+
+// NewFileTokenStore creates a store keeping the token in the file at path.
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{path: path}
+}
+
+func (s *FileTokenStore) Load() (*StoredToken, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.keys != nil {
+		if !isEncrypted(b) {
+			return nil, fmt.Errorf("token file %s is not encrypted, but a key is given", s.path)
+		}
+		if b, err = s.keys.decrypt(b); err != nil {
+			return nil, fmt.Errorf("could not decrypt token file %s: %w", s.path, err)
+		}
+	} else if isEncrypted(b) {
+		return nil, fmt.Errorf("token file %s is encrypted, but no key is given", s.path)
+	}
+
+	var t StoredToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("could not decode token file %s: %w", s.path, err)
+	}
+	if t.Token == nil {
+		return nil, ErrNoToken
+	}
+	return &t, nil
+}
+
+// Save writes the token to a temporary file first and renames it, so that
+// a crash never leaves a half written token behind.
+func (s *FileTokenStore) Save(t *StoredToken) error {
+	b, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if s.keys != nil {
+		if b, err = s.keys.encrypt(b); err != nil {
+			return fmt.Errorf("could not encrypt token: %w", err)
+		}
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(0o600); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// memoryTokenStore keeps the token of a client without a TokenStore.
+type memoryTokenStore struct {
+	mu sync.Mutex
+	t  *StoredToken
+}
+
+func (s *memoryTokenStore) Load() (*StoredToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.t == nil {
+		return nil, ErrNoToken
+	}
+	return s.t, nil
+}
+
+func (s *memoryTokenStore) Save(t *StoredToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.t = t
+	return nil
+}
+
+const (
+	minRefreshBackoff = time.Minute
+	maxRefreshBackoff = time.Hour
+
+	// transientRefreshBackoff is how long the error of a refresh which
+	// failed for other reasons than a rejection is returned without
+	// asking the token endpoint again.
+	transientRefreshBackoff = 30 * time.Second
+)
+
+// storeTokenSource refreshes the token through the store. When several
+// processes share a store, only one of them may refresh at a time: Netatmo
+// invalidates the old refresh token, so the others have to pick up the
+// token written by the one which refreshed instead of refreshing again.
+//
+// When the token endpoint rejects the refresh token, the client needs to be
+// authorized again. Until then, refreshes are retried with an exponential
+// backoff, or as soon as another refresh token shows up in the store.
+// Other errors, like timeouts, rate limits or server errors, do not need a
+// new authorization: they are returned for transientRefreshBackoff, so that
+// the requests of a scrape do not each hit the token endpoint again, and
+// the refresh is tried again afterwards.
+type storeTokenSource struct {
+	ctx   context.Context
+	oauth *oauth2.Config
+	store TokenStore
+
+	mu       sync.Mutex
+	stored   *StoredToken
+	invalid  string
+	failures int
+	failed   string
+	retryAt  time.Time
+
+	// the last transient refresh error, returned until transientUntil
+	transientErr   error
+	transientUntil time.Time
+
+	// reauth mirrors failures > 0, so that it can be read while a refresh
+	// holds mu
+	reauth atomic.Bool
+}
+
+func (s *storeTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stored.Token.Valid() {
+		return s.stored.Token, nil
+	}
+
+	if l, ok := s.store.(TokenLocker); ok {
+		unlock, err := l.Lock()
+		if err != nil {
+			return nil, fmt.Errorf("could not lock token store: %w", err)
+		}
+		defer unlock()
+	}
+
+	stored, err := s.store.Load()
+	switch {
+	case err == nil && stored.Token.Valid() && stored.Token.AccessToken != s.invalid:
+		// another process refreshed the token in the meantime
+		s.stored = stored
+		s.setFailures(0)
+		return stored.Token, nil
+	case err == nil && stored.Token.RefreshToken != "" && stored.Token.RefreshToken != s.stored.Token.RefreshToken:
+		// the stored refresh token is the newest, ours may already be
+		// invalidated by a refresh of another process
+		s.stored = &StoredToken{
+			Token:      &oauth2.Token{RefreshToken: stored.Token.RefreshToken},
+			Scopes:     stored.Scopes,
+			ObtainedAt: stored.ObtainedAt,
+		}
+	case err != nil && !errors.Is(err, ErrNoToken):
+		return nil, fmt.Errorf("could not load token: %w", err)
+	}
+
+	if s.failures > 0 && s.stored.Token.RefreshToken == s.failed && time.Now().Before(s.retryAt) {
+		return nil, ErrNeedsReauth
+	}
+
+	if s.transientErr != nil && s.stored.Token.RefreshToken == s.failed && time.Now().Before(s.transientUntil) {
+		return nil, s.transientErr
+	}
+
+	t, err := s.oauth.TokenSource(s.ctx, s.stored.Token).Token()
+	if err != nil && !isGrantRejected(err) {
+		s.failed = s.stored.Token.RefreshToken
+		s.transientErr = fmt.Errorf("could not refresh token: %w", err)
+		s.transientUntil = time.Now().Add(transientRefreshBackoff)
+		slog.Warn("Could not refresh token", "retry_in", transientRefreshBackoff, "err", err)
+		return nil, s.transientErr
+	}
+	s.transientErr = nil
+	if err != nil {
+		s.setFailures(s.failures + 1)
+		s.failed = s.stored.Token.RefreshToken
+		backoff := minRefreshBackoff << (s.failures - 1)
+		if backoff > maxRefreshBackoff || backoff <= 0 {
+			backoff = maxRefreshBackoff
+		}
+		s.retryAt = time.Now().Add(backoff)
+		slog.Error("Could not refresh token, has to be authorized again", "retry_in", backoff, "err", err)
+		return nil, fmt.Errorf("%w: could not refresh token: %v", ErrNeedsReauth, err)
+	}
+	s.setFailures(0)
+	slog.Debug("Refreshed token", "expiry", t.Expiry)
+
+	s.stored = &StoredToken{
+		Token:      t,
+		Scopes:     grantedScopes(t),
+		ObtainedAt: time.Now(),
+	}
+	if err := s.store.Save(s.stored); err != nil {
+		// the token is still good for this process, only a restart
+		// would need the refresh token which could not be saved
+		slog.Error("Could not save token", "err", err)
+	}
+	return t, nil
+}
+
+// invalidate drops the access token after the API rejected it, so that
+// the next call of Token refreshes it.
+func (s *storeTokenSource) invalidate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stored.Token.AccessToken != accessToken {
+		// refreshed since the request was sent
+		return
+	}
+
+	s.invalid = accessToken
+	s.stored = &StoredToken{
+		Token:      &oauth2.Token{RefreshToken: s.stored.Token.RefreshToken},
+		Scopes:     s.stored.Scopes,
+		ObtainedAt: s.stored.ObtainedAt,
+	}
+}
+
+// current returns the token as last loaded or refreshed.
+func (s *storeTokenSource) current() *StoredToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stored
+}
+
+// grantedScopes returns the scopes the token endpoint reported for t, or
+// nil if it did not.
+func grantedScopes(t *oauth2.Token) []string {
+	switch v := t.Extra("scope").(type) {
+	case []interface{}:
+		scopes := make([]string, 0, len(v))
+		for _, scope := range v {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+		return scopes
+	case string:
+		return strings.Fields(v)
+	default:
+		return nil
+	}
+}
+
+// setFailures sets the number of rejected refreshes in a row. s.mu has to
+// be held.
+func (s *storeTokenSource) setFailures(n int) {
+	s.failures = n
+	s.reauth.Store(n > 0)
+}
+
+// needsReauth reports whether the token endpoint rejected the last refresh.
+// It does not wait for a refresh in progress.
+func (s *storeTokenSource) needsReauth() bool {
+	return s.reauth.Load()
+}
+
+// isGrantRejected reports whether err tells that the token endpoint
+// rejected the refresh token or the client, so that retrying cannot help.
+// Rate limits, server errors and network errors are not rejections.
+func isGrantRejected(err error) bool {
+	var re *oauth2.RetrieveError
+	if !errors.As(err, &re) {
+		return false
+	}
+	if re.ErrorCode == "invalid_grant" || re.ErrorCode == "invalid_client" || re.ErrorCode == "unauthorized_client" {
+		return true
+	}
+	if re.Response == nil {
+		return false
+	}
+	code := re.Response.StatusCode
+	return code >= 400 && code < 500 && code != http.StatusTooManyRequests && code != http.StatusRequestTimeout
+}
@@ -0,0 +1,124 @@
+package netatmo_api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tokenKeySize is the size of the AES-256 keys encrypting token files.
+const tokenKeySize = 32
+
+// TokenKeys are the keys of an encrypted token file. The first key
+// encrypts, all of them decrypt, so a key can be rotated by putting the new
+// one first: the file is encrypted with it on the next save.
+type TokenKeys struct {
+	keys []*tokenKey
+}
+
+type tokenKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// encryptedToken is the content of an encrypted token file.
+type encryptedToken struct {
+	KeyId      string `json:"key_id"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ParseTokenKeys parses base64 encoded 32 byte keys separated by newlines or
+// commas, the current key first.
+func ParseTokenKeys(s string) (*TokenKeys, error) {
+	keys := &TokenKeys{}
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(field)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode token key: %w", err)
+		}
+		if len(key) != tokenKeySize {
+			return nil, fmt.Errorf("token key has %d bytes instead of %d", len(key), tokenKeySize)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.Sum256(key)
+		keys.keys = append(keys.keys, &tokenKey{id: hex.EncodeToString(sum[:4]), aead: aead})
+	}
+
+	if len(keys.keys) == 0 {
+		return nil, errors.New("no token key given")
+	}
+	return keys, nil
+}
+
+// NewEncryptedFileTokenStore creates a store keeping the token in the file
+// at path, encrypted with AES-GCM.
+func NewEncryptedFileTokenStore(path string, keys *TokenKeys) *FileTokenStore {
+	return &FileTokenStore{path: path, keys: keys}
+}
+
+// isEncrypted reports whether b is the content of an encrypted token file.
+func isEncrypted(b []byte) bool {
+	var e encryptedToken
+	return json.Unmarshal(b, &e) == nil && e.Ciphertext != nil
+}
+
+func (k *TokenKeys) encrypt(plaintext []byte) ([]byte, error) {
+	key := k.keys[0]
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&encryptedToken{
+		KeyId:      key.id,
+		Nonce:      nonce,
+		Ciphertext: key.aead.Seal(nil, nonce, plaintext, []byte(key.id)),
+	}, "", "  ")
+}
+
+func (k *TokenKeys) decrypt(b []byte) ([]byte, error) {
+	var e encryptedToken
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	if e.Ciphertext == nil {
+		return nil, errors.New("file is not encrypted")
+	}
+
+	for _, key := range k.keys {
+		if key.id != e.KeyId {
+			continue
+		}
+		if len(e.Nonce) != key.aead.NonceSize() {
+			return nil, errors.New("file has an invalid nonce")
+		}
+		plaintext, err := key.aead.Open(nil, e.Nonce, e.Ciphertext, []byte(e.KeyId))
+		if err != nil {
+			return nil, fmt.Errorf("file was tampered with: %w", err)
+		}
+		return plaintext, nil
+	}
+	return nil, fmt.Errorf("no key with id %s given", e.KeyId)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package netatmo_api
+
+// Lock does nothing on platforms without flock, so a token file must not
+// be shared between processes there.
+func (s *FileTokenStore) Lock() (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,27 @@
+//go:build unix
+
+package netatmo_api
+
+import (
+	"os"
+	"syscall"
+)
+
+// Lock takes an exclusive flock on the lock file of the store. The token
+// file itself cannot be locked, as Save replaces it.
+func (s *FileTokenStore) Lock() (func(), error) {
+	f, err := os.OpenFile(s.path+".lock", os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return func() {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		_ = f.Close()
+	}, nil
+}
@@ -0,0 +1,348 @@
+package netatmo_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// tokenServer answers refreshes with status and body and counts them.
+func tokenServer(t *testing.T, status int, body string) (*oauth2.Config, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+
+	return &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{TokenURL: srv.URL, AuthStyle: oauth2.AuthStyleInParams},
+	}, &requests
+}
+
+func expiredTokenSource(oauth *oauth2.Config) *storeTokenSource {
+	stored := &StoredToken{Token: &oauth2.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	}}
+	return &storeTokenSource{
+		ctx:    context.Background(),
+		oauth:  oauth,
+		store:  &memoryTokenStore{t: stored},
+		stored: stored,
+	}
+}
+
+func TestStoreTokenSourceRefreshErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		wantReauth bool
+	}{
+		{"invalid grant", http.StatusBadRequest, `{"error":"invalid_grant"}`, true},
+		{"invalid client", http.StatusUnauthorized, `{"error":"invalid_client"}`, true},
+		{"other client error", http.StatusForbidden, `{}`, true},
+		{"server error", http.StatusInternalServerError, `{}`, false},
+		{"bad gateway", http.StatusBadGateway, `<html></html>`, false},
+		{"rate limited", http.StatusTooManyRequests, `{}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oauth, requests := tokenServer(t, tt.status, tt.body)
+			s := expiredTokenSource(oauth)
+
+			// the second call backs off instead of asking again
+			for i := 0; i < 2; i++ {
+				_, err := s.Token()
+				if err == nil {
+					t.Fatal("Token succeeded")
+				}
+				if got := errors.Is(err, ErrNeedsReauth); got != tt.wantReauth {
+					t.Errorf("errors.Is(%v, ErrNeedsReauth) = %v, want %v", err, got, tt.wantReauth)
+				}
+				if got := s.needsReauth(); got != tt.wantReauth {
+					t.Errorf("needsReauth() = %v, want %v", got, tt.wantReauth)
+				}
+			}
+			if n := requests.Load(); n != 1 {
+				t.Errorf("token endpoint got %d requests, want 1", n)
+			}
+		})
+	}
+}
+
+func TestStoreTokenSourceNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	s := expiredTokenSource(&oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: url}})
+	for i := 0; i < 3; i++ {
+		if _, err := s.Token(); err == nil || errors.Is(err, ErrNeedsReauth) {
+			t.Fatalf("Token() = %v, want a network error", err)
+		}
+	}
+	if s.needsReauth() {
+		t.Error("needsReauth() = true after network errors")
+	}
+}
+
+func TestStoreTokenSourceRetriesAfterTransientError(t *testing.T) {
+	oauth, requests := tokenServer(t, http.StatusTooManyRequests, `{}`)
+	s := expiredTokenSource(oauth)
+	if _, err := s.Token(); err == nil {
+		t.Fatal("Token succeeded")
+	}
+
+	// the backoff has passed
+	s.transientUntil = time.Now().Add(-time.Second)
+	if _, err := s.Token(); err == nil || errors.Is(err, ErrNeedsReauth) {
+		t.Fatalf("Token() = %v, want a transient error", err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("token endpoint got %d requests, want 2", n)
+	}
+}
+
+func TestStoreTokenSourceRecovers(t *testing.T) {
+	oauth, _ := tokenServer(t, http.StatusBadRequest, `{"error":"invalid_grant"}`)
+	s := expiredTokenSource(oauth)
+	if _, err := s.Token(); !errors.Is(err, ErrNeedsReauth) {
+		t.Fatalf("Token() = %v, want ErrNeedsReauth", err)
+	}
+
+	// a new refresh token shows up in the store, e.g. after login
+	s.oauth, _ = tokenServer(t, http.StatusOK, `{"access_token":"new","refresh_token":"new-refresh","expires_in":3600}`)
+	_ = s.store.Save(&StoredToken{Token: &oauth2.Token{RefreshToken: "login"}})
+
+	token, err := s.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "new" {
+		t.Errorf("access token = %q, want new", token.AccessToken)
+	}
+	if s.needsReauth() {
+		t.Error("needsReauth() = true after a successful refresh")
+	}
+}
+
+func TestStoreTokenSourceNeedsReauthDoesNotBlock(t *testing.T) {
+	oauth, _ := tokenServer(t, http.StatusOK, `{}`)
+	s := expiredTokenSource(oauth)
+
+	// a refresh in progress holds mu
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	done := make(chan bool)
+	go func() { done <- s.needsReauth() }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("needsReauth blocked while a refresh holds the lock")
+	}
+}
+
+// testKey returns a base64 encoded token key made of b.
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, tokenKeySize))
+}
+
+func mustParseTokenKeys(t *testing.T, s string) *TokenKeys {
+	t.Helper()
+
+	keys, err := ParseTokenKeys(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func testStoredToken() *StoredToken {
+	return &StoredToken{
+		Token:      &oauth2.Token{AccessToken: "at-secret", RefreshToken: "rt-secret"},
+		Scopes:     []string{ReadThermostat},
+		ObtainedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// tamperTokenFile rewrites the encrypted token file at path with change
+// applied.
+func tamperTokenFile(t *testing.T, path string, change func(e *encryptedToken)) {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e encryptedToken
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatal(err)
+	}
+	change(&e)
+	if b, err = json.Marshal(&e); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTokenKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    int
+		wantErr string
+	}{
+		{"one key", testKey(1), 1, ""},
+		{"comma separated", testKey(1) + "," + testKey(2), 2, ""},
+		{"key file", testKey(1) + "\r\n" + testKey(2) + "\n\n", 2, ""},
+		{"bad base64", "not base64!", 0, "could not decode token key"},
+		{"short key", base64.StdEncoding.EncodeToString(make([]byte, 16)), 0, "16 bytes instead of 32"},
+		{"long key", base64.StdEncoding.EncodeToString(make([]byte, 64)), 0, "64 bytes instead of 32"},
+		{"one bad key of two", testKey(1) + ",AAAA", 0, "3 bytes instead of 32"},
+		{"no key", " \n", 0, "no token key given"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := ParseTokenKeys(tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ParseTokenKeys() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys.keys) != tt.want {
+				t.Errorf("got %d keys, want %d", len(keys.keys), tt.want)
+			}
+		})
+	}
+}
+
+func TestEncryptedFileTokenStore(t *testing.T) {
+	keyA, keyB := testKey(0xa), testKey(0xb)
+
+	tests := []struct {
+		name      string
+		saveKeys  string
+		loadKeys  string
+		wantKeyId string
+	}{
+		{"round trip", keyA, keyA, keyA},
+		// the file was written before A was added, the next save uses A
+		{"rotation", keyB, keyA + "," + keyB, keyA},
+		{"old key still listed", keyA + "," + keyB, keyB + "\n" + keyA, keyB},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token.json")
+			want := testStoredToken()
+			if err := NewEncryptedFileTokenStore(path, mustParseTokenKeys(t, tt.saveKeys)).Save(want); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(b, []byte("secret")) {
+				t.Errorf("token file is not encrypted:\n%s", b)
+			}
+
+			store := NewEncryptedFileTokenStore(path, mustParseTokenKeys(t, tt.loadKeys))
+			got, err := store.Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if toJSON(t, got) != toJSON(t, want) {
+				t.Errorf("loaded %s, want %s", toJSON(t, got), toJSON(t, want))
+			}
+
+			if err := store.Save(got); err != nil {
+				t.Fatal(err)
+			}
+			if b, err = os.ReadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			var e encryptedToken
+			if err := json.Unmarshal(b, &e); err != nil {
+				t.Fatal(err)
+			}
+			if wantId := mustParseTokenKeys(t, tt.wantKeyId).keys[0].id; e.KeyId != wantId {
+				t.Errorf("saved with key %s, want %s", e.KeyId, wantId)
+			}
+		})
+	}
+}
+
+func TestFileTokenStoreLoadErrors(t *testing.T) {
+	keyA, keyB := testKey(0xa), testKey(0xb)
+
+	tests := []struct {
+		name     string
+		saveKeys string
+		change   func(e *encryptedToken)
+		loadKeys string
+		wantErr  string
+	}{
+		{"unknown key", keyA, nil, keyB, "no key with id"},
+		{"rotated out key", keyA, nil, keyB + "," + testKey(0xc), "no key with id"},
+		{"tampered ciphertext", keyA, func(e *encryptedToken) { e.Ciphertext[0] ^= 1 }, keyA, "tampered"},
+		{"tampered nonce", keyA, func(e *encryptedToken) { e.Nonce[0] ^= 1 }, keyA, "tampered"},
+		{"short nonce", keyA, func(e *encryptedToken) { e.Nonce = e.Nonce[:4] }, keyA, "invalid nonce"},
+		{"plaintext file with key", "", nil, keyA, "is not encrypted, but a key is given"},
+		{"encrypted file without key", keyA, nil, "", "is encrypted, but no key is given"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "token.json")
+			store := func(keys string) *FileTokenStore {
+				if keys == "" {
+					return NewFileTokenStore(path)
+				}
+				return NewEncryptedFileTokenStore(path, mustParseTokenKeys(t, keys))
+			}
+
+			if err := store(tt.saveKeys).Save(testStoredToken()); err != nil {
+				t.Fatal(err)
+			}
+			if tt.change != nil {
+				tamperTokenFile(t, path, tt.change)
+			}
+
+			_, err := store(tt.loadKeys).Load()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/version"
+	"github.com/tipok/netatmo_exporter/collector"
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// Exit codes of the oneshot mode. Metrics are written for partial failures,
+// but not for the others, so the file keeps the metrics of the last run
+// which got any.
+const (
+	exitFailure        = 1
+	exitPartialFailure = 3
+	exitAuthFailure    = 4
+)
+
+// runOneshot collects the metrics of c once and writes them in the text
+// format to output, replacing the file atomically so that node_exporter
+// never reads a partial file. It returns the exit code.
+func runOneshot(client *netatmo.Client, c *collector.Collector, output string) int {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(version.NewCollector("netatmo_exporter"))
+	registry.MustRegister(c)
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		slog.Error("Could not gather metrics", "err", err)
+		return exitFailure
+	}
+
+	if client.NeedsReauth() {
+		slog.Error("Token could not be refreshed, the exporter has to be authorized again")
+		return exitAuthFailure
+	}
+
+	failed := c.Failed()
+	if len(failed) > 0 && len(failed) == len(c.Enabled()) {
+		slog.Error("All collectors failed", "collectors", strings.Join(failed, ","))
+		return exitFailure
+	}
+	if c.HomesFailed() {
+		slog.Error("Could not get the status of any home", "collectors", strings.Join(failed, ","))
+		return exitFailure
+	}
+
+	if output == "-" {
+		enc := expfmt.NewEncoder(os.Stdout, expfmt.FmtText)
+		for _, mf := range mfs {
+			if err := enc.Encode(mf); err != nil {
+				slog.Error("Could not write metrics", "err", err)
+				return exitFailure
+			}
+		}
+	} else if err := prometheus.WriteToTextfile(output, gathered(mfs)); err != nil {
+		slog.Error("Could not write metrics", "file", output, "err", err)
+		return exitFailure
+	}
+
+	if len(failed) > 0 {
+		slog.Warn("Collectors failed", "collectors", strings.Join(failed, ","))
+		return exitPartialFailure
+	}
+	return 0
+}
+
+// gathered returns already gathered metric families again, so they are not
+// collected a second time for writing.
+type gathered []*dto.MetricFamily
+
+func (g gathered) Gather() ([]*dto.MetricFamily, error) {
+	return g, nil
+}
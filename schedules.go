@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+	"gopkg.in/yaml.v3"
+)
+
+const schedulesUsage = `Usage: netatmo_exporter schedules <command> [flags]
+
+Commands:
+  export   write all heating schedules as YAML
+  diff     compare a YAML file with the live schedules
+  restore  restore a schedule from a YAML file
+`
+
+// Exit codes of schedules diff, the same as those of diff(1).
+const (
+	exitDiffChanged = 1
+	exitDiffTrouble = 2
+)
+
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// scheduleBackup is the human editable YAML representation of the heating
+// schedules of all homes.
+type scheduleBackup struct {
+	Homes []*homeBackup `yaml:"homes"`
+}
+
+type homeBackup struct {
+	Id        string                 `yaml:"id"`
+	Name      string                 `yaml:"name"`
+	Timezone  string                 `yaml:"timezone,omitempty"`
+	Schedules []*scheduleBackupEntry `yaml:"schedules"`
+}
+
+type scheduleBackupEntry struct {
+	Id        string          `yaml:"id,omitempty"`
+	Name      string          `yaml:"name"`
+	Selected  bool            `yaml:"selected,omitempty"`
+	AwayTemp  *float64        `yaml:"away_temp,omitempty"`
+	HgTemp    *float64        `yaml:"hg_temp,omitempty"`
+	Zones     []*zoneBackup   `yaml:"zones"`
+	Timetable []*switchBackup `yaml:"timetable"`
+}
+
+type zoneBackup struct {
+	Id    int               `yaml:"id"`
+	Name  string            `yaml:"name"`
+	Type  int               `yaml:"type"`
+	Rooms []*zoneRoomBackup `yaml:"rooms"`
+}
+
+type zoneRoomBackup struct {
+	Id          string  `yaml:"id"`
+	Name        string  `yaml:"name,omitempty"`
+	Temperature float64 `yaml:"temperature"`
+}
+
+// switchBackup switches the schedule to the zone with the given name at a
+// time of a day instead of Netatmo's minutes since the start of the week.
+type switchBackup struct {
+	Day  string `yaml:"day"`
+	Time string `yaml:"time"`
+	Zone string `yaml:"zone"`
+}
+
+func runSchedules(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, schedulesUsage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportSchedules(args[1:])
+	case "diff":
+		changed, err := diffSchedulesFile(args[1:])
+		if err != nil {
+			fatalWithCode(err, exitDiffTrouble)
+		}
+		if changed {
+			os.Exit(exitDiffChanged)
+		}
+		return
+	case "restore":
+		err = restoreSchedule(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, schedulesUsage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func exportSchedules(args []string) error {
+	fs := flag.NewFlagSet("schedules export", flag.ExitOnError)
+	var cf clientFlags
+	var home string
+	var output string
+	cf.register(fs)
+	fs.StringVar(&home, "home", "", "Only export the schedules of this home id")
+	fs.StringVar(&output, "output", "-", "File to write the schedules to, - for stdout")
+	parseFlags(fs, args)
+
+	client, err := cf.newClient(context.Background(), netatmo.ReadThermostat)
+	if err != nil {
+		return err
+	}
+
+	homesData, err := client.GetHomesData()
+	if err != nil {
+		return err
+	}
+
+	backup := &scheduleBackup{}
+	for _, h := range homesData.Homes {
+		if home != "" && h.Id != home {
+			continue
+		}
+		backup.Homes = append(backup.Homes, newHomeBackup(h))
+	}
+
+	if output == "-" {
+		return writeScheduleBackup(os.Stdout, backup)
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := writeScheduleBackup(f, backup); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func diffSchedulesFile(args []string) (bool, error) {
+	fs := flag.NewFlagSet("schedules diff", flag.ExitOnError)
+	var cf clientFlags
+	var file string
+	cf.register(fs)
+	fs.StringVar(&file, "file", "", "YAML file with the schedules")
+	parseFlags(fs, args)
+
+	backup, err := readScheduleBackup(file)
+	if err != nil {
+		return false, err
+	}
+
+	client, err := cf.newClient(context.Background(), netatmo.ReadThermostat)
+	if err != nil {
+		return false, err
+	}
+
+	homesData, err := client.GetHomesData()
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, hb := range backup.Homes {
+		live := findHome(homesData, hb.Id)
+		if live == nil {
+			fmt.Printf("home %s: does not exist\n", hb.Id)
+			changed = true
+			continue
+		}
+
+		seen := make(map[string]bool)
+		for _, sb := range hb.Schedules {
+			want, err := sb.schedule()
+			if err != nil {
+				return false, fmt.Errorf("home %s: %w", hb.Id, err)
+			}
+
+			have := findSchedule(live, want.Id, want.Name)
+			if have == nil {
+				fmt.Printf("home %s: schedule %s: does not exist\n", live.Name, want.Name)
+				changed = true
+				continue
+			}
+			seen[have.Id] = true
+
+			for _, d := range diffSchedules(have, want, roomNames(live)) {
+				fmt.Printf("home %s: schedule %s: %s\n", live.Name, have.Name, d)
+				changed = true
+			}
+		}
+
+		for _, s := range live.ThermostatSchedules() {
+			if !seen[s.Id] {
+				fmt.Printf("home %s: schedule %s: not in %s\n", live.Name, s.Name, file)
+				changed = true
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+func restoreSchedule(args []string) error {
+	fs := flag.NewFlagSet("schedules restore", flag.ExitOnError)
+	var cf clientFlags
+	var file string
+	var home string
+	var schedule string
+	var dryRun bool
+	cf.register(fs)
+	fs.StringVar(&file, "file", "", "YAML file with the schedules")
+	fs.StringVar(&home, "home", "", "Home id of the schedule, required if the file contains several homes")
+	fs.StringVar(&schedule, "schedule", "", "Id or name of the schedule to restore")
+	fs.BoolVar(&dryRun, "dry-run", false, "Only show the changes, do not apply them")
+	parseFlags(fs, args)
+
+	if schedule == "" {
+		return errors.New("schedule has to be provided")
+	}
+
+	backup, err := readScheduleBackup(file)
+	if err != nil {
+		return err
+	}
+
+	hb, err := backup.home(home)
+	if err != nil {
+		return err
+	}
+
+	sb := hb.find(schedule)
+	if sb == nil {
+		return fmt.Errorf("schedule %s not found in %s", schedule, file)
+	}
+
+	want, err := sb.schedule()
+	if err != nil {
+		return err
+	}
+
+	client, err := cf.newClient(context.Background(), netatmo.ReadThermostat, netatmo.WriteThermostat)
+	if err != nil {
+		return err
+	}
+
+	homesData, err := client.GetHomesData()
+	if err != nil {
+		return err
+	}
+
+	live := findHome(homesData, hb.Id)
+	if live == nil {
+		return fmt.Errorf("home %s does not exist", hb.Id)
+	}
+
+	have := findSchedule(live, want.Id, want.Name)
+	if have == nil {
+		fmt.Printf("schedule %s will be created:\n", want.Name)
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		if err := enc.Encode(sb); err != nil {
+			return err
+		}
+		if dryRun {
+			fmt.Println("dry run, nothing changed")
+			return nil
+		}
+
+		id, err := client.CreateHomeSchedule(live.Id, want)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("schedule %s created with id %s\n", want.Name, id)
+		return nil
+	}
+
+	diff := diffSchedules(have, want, roomNames(live))
+	if len(diff) == 0 {
+		fmt.Printf("schedule %s is up to date\n", have.Name)
+		return nil
+	}
+
+	for _, d := range diff {
+		fmt.Printf("schedule %s: %s\n", have.Name, d)
+	}
+	if dryRun {
+		fmt.Println("dry run, nothing changed")
+		return nil
+	}
+
+	want.Id = have.Id
+	if err := client.SyncHomeSchedule(live.Id, want); err != nil {
+		return err
+	}
+	fmt.Printf("schedule %s restored\n", have.Name)
+	return nil
+}
+
+func writeScheduleBackup(w io.Writer, backup *scheduleBackup) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(backup); err != nil {
+		return fmt.Errorf("could not encode schedules: %w", err)
+	}
+	return enc.Close()
+}
+
+func readScheduleBackup(file string) (*scheduleBackup, error) {
+	if file == "" {
+		return nil, errors.New("file has to be provided")
+	}
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var backup scheduleBackup
+	if err := yaml.Unmarshal(b, &backup); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", file, err)
+	}
+	return &backup, nil
+}
+
+func newHomeBackup(h *netatmo.Home) *homeBackup {
+	names := roomNames(h)
+
+	hb := &homeBackup{
+		Id:       h.Id,
+		Name:     h.Name,
+		Timezone: h.Timezone,
+	}
+
+	for _, s := range h.ThermostatSchedules() {
+		sb := &scheduleBackupEntry{
+			Id:       s.Id,
+			Name:     s.Name,
+			Selected: s.Selected,
+			AwayTemp: s.AwayTemp,
+			HgTemp:   s.HgTemp,
+		}
+
+		for _, z := range s.Zones {
+			zb := &zoneBackup{
+				Id:   z.Id,
+				Name: z.Name,
+				Type: z.Type,
+			}
+			for _, r := range z.Rooms {
+				zb.Rooms = append(zb.Rooms, &zoneRoomBackup{
+					Id:          r.Id,
+					Name:        names[r.Id],
+					Temperature: r.SetPointTemperature,
+				})
+			}
+			sb.Zones = append(sb.Zones, zb)
+		}
+
+		for _, e := range sortedTimetable(s.Timetable) {
+			zone := strconv.Itoa(e.ZoneId)
+			if z := s.Zone(e.ZoneId); z != nil {
+				zone = z.Name
+			}
+			sb.Timetable = append(sb.Timetable, &switchBackup{
+				Day:  weekdays[e.MOffset/(24*60)%7],
+				Time: fmt.Sprintf("%02d:%02d", e.MOffset%(24*60)/60, e.MOffset%60),
+				Zone: zone,
+			})
+		}
+
+		hb.Schedules = append(hb.Schedules, sb)
+	}
+
+	return hb
+}
+
+func (b *scheduleBackup) home(id string) (*homeBackup, error) {
+	if id == "" {
+		if len(b.Homes) != 1 {
+			return nil, errors.New("home has to be provided if there is not exactly one home")
+		}
+		return b.Homes[0], nil
+	}
+
+	for _, h := range b.Homes {
+		if h.Id == id {
+			return h, nil
+		}
+	}
+	return nil, fmt.Errorf("home %s not found", id)
+}
+
+func (h *homeBackup) find(schedule string) *scheduleBackupEntry {
+	for _, s := range h.Schedules {
+		if s.Id == schedule || s.Name == schedule {
+			return s
+		}
+	}
+	return nil
+}
+
+// schedule converts the YAML representation back into the API model.
+func (sb *scheduleBackupEntry) schedule() (*netatmo.Schedule, error) {
+	s := &netatmo.Schedule{
+		Id:       sb.Id,
+		Name:     sb.Name,
+		Selected: sb.Selected,
+		AwayTemp: sb.AwayTemp,
+		HgTemp:   sb.HgTemp,
+	}
+
+	zones := make(map[string]int)
+	for _, zb := range sb.Zones {
+		z := &netatmo.Zone{
+			Id:   zb.Id,
+			Name: zb.Name,
+			Type: zb.Type,
+		}
+		for _, r := range zb.Rooms {
+			z.Rooms = append(z.Rooms, &netatmo.ZoneRoom{
+				Id:                  r.Id,
+				SetPointTemperature: r.Temperature,
+			})
+		}
+		s.Zones = append(s.Zones, z)
+		zones[zb.Name] = zb.Id
+	}
+
+	for _, sw := range sb.Timetable {
+		offset, err := parseWeekOffset(sw.Day, sw.Time)
+		if err != nil {
+			return nil, fmt.Errorf("schedule %s: %w", sb.Name, err)
+		}
+
+		zone, ok := zones[sw.Zone]
+		if !ok {
+			id, err := strconv.Atoi(sw.Zone)
+			if err != nil || s.Zone(id) == nil {
+				return nil, fmt.Errorf("schedule %s: unknown zone %q", sb.Name, sw.Zone)
+			}
+			zone = id
+		}
+
+		s.Timetable = append(s.Timetable, &netatmo.TimetableEntry{ZoneId: zone, MOffset: offset})
+	}
+	s.Timetable = sortedTimetable(s.Timetable)
+
+	return s, nil
+}
+
+func parseWeekOffset(day string, at string) (int, error) {
+	weekday := -1
+	for i, d := range weekdays {
+		if strings.EqualFold(d, day) {
+			weekday = i
+		}
+	}
+	if weekday < 0 {
+		return 0, fmt.Errorf("invalid day %q", day)
+	}
+
+	var hour, minute int
+	if _, err := fmt.Sscanf(at, "%d:%d", &hour, &minute); err != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q of %s", at, day)
+	}
+
+	return weekday*24*60 + hour*60 + minute, nil
+}
+
+// diffSchedules returns a human readable line for every difference between
+// the live schedule have and the schedule want.
+func diffSchedules(have *netatmo.Schedule, want *netatmo.Schedule, rooms map[string]string) []string {
+	var diff []string
+
+	if have.Name != want.Name {
+		diff = append(diff, fmt.Sprintf("name %q -> %q", have.Name, want.Name))
+	}
+	if d := diffTemperature("away temperature", have.AwayTemp, want.AwayTemp); d != "" {
+		diff = append(diff, d)
+	}
+	if d := diffTemperature("frost guard temperature", have.HgTemp, want.HgTemp); d != "" {
+		diff = append(diff, d)
+	}
+
+	for _, wz := range want.Zones {
+		hz := have.Zone(wz.Id)
+		if hz == nil {
+			diff = append(diff, fmt.Sprintf("zone %s: added", wz.Name))
+			continue
+		}
+		if hz.Name != wz.Name {
+			diff = append(diff, fmt.Sprintf("zone %d: name %q -> %q", wz.Id, hz.Name, wz.Name))
+		}
+		for _, r := range wz.Rooms {
+			room := r.Id
+			if name, ok := rooms[r.Id]; ok {
+				room = name
+			}
+			t, ok := hz.RoomTemperature(r.Id)
+			if !ok {
+				diff = append(diff, fmt.Sprintf("zone %s: room %s: temperature %v added", wz.Name, room, r.SetPointTemperature))
+			} else if t != r.SetPointTemperature {
+				diff = append(diff, fmt.Sprintf("zone %s: room %s: temperature %v -> %v", wz.Name, room, t, r.SetPointTemperature))
+			}
+		}
+	}
+	for _, hz := range have.Zones {
+		if want.Zone(hz.Id) == nil {
+			diff = append(diff, fmt.Sprintf("zone %s: removed", hz.Name))
+		}
+	}
+
+	haveEntries := timetableEntries(have)
+	wantEntries := timetableEntries(want)
+	for _, e := range haveEntries {
+		if !containsString(wantEntries, e) {
+			diff = append(diff, "timetable: - "+e)
+		}
+	}
+	for _, e := range wantEntries {
+		if !containsString(haveEntries, e) {
+			diff = append(diff, "timetable: + "+e)
+		}
+	}
+
+	return diff
+}
+
+func diffTemperature(name string, have *float64, want *float64) string {
+	switch {
+	case have == nil && want == nil:
+		return ""
+	case have == nil:
+		return fmt.Sprintf("%s %v added", name, *want)
+	case want == nil:
+		return fmt.Sprintf("%s %v removed", name, *have)
+	case *have != *want:
+		return fmt.Sprintf("%s %v -> %v", name, *have, *want)
+	}
+	return ""
+}
+
+func timetableEntries(s *netatmo.Schedule) []string {
+	var entries []string
+	for _, e := range sortedTimetable(s.Timetable) {
+		zone := strconv.Itoa(e.ZoneId)
+		if z := s.Zone(e.ZoneId); z != nil {
+			zone = z.Name
+		}
+		entries = append(entries, fmt.Sprintf(
+			"%s %02d:%02d %s",
+			weekdays[e.MOffset/(24*60)%7],
+			e.MOffset%(24*60)/60,
+			e.MOffset%60,
+			zone,
+		))
+	}
+	return entries
+}
+
+func sortedTimetable(timetable []*netatmo.TimetableEntry) []*netatmo.TimetableEntry {
+	sorted := append([]*netatmo.TimetableEntry{}, timetable...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].MOffset < sorted[j].MOffset
+	})
+	return sorted
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func findHome(homesData *netatmo.HomesData, id string) *netatmo.Home {
+	for _, h := range homesData.Homes {
+		if h.Id == id {
+			return h
+		}
+	}
+	return nil
+}
+
+// findSchedule finds a schedule by its id, or by its name if it has none.
+func findSchedule(h *netatmo.Home, id string, name string) *netatmo.Schedule {
+	for _, s := range h.ThermostatSchedules() {
+		if (id != "" && s.Id == id) || (id == "" && s.Name == name) {
+			return s
+		}
+	}
+	return nil
+}
+
+func roomNames(h *netatmo.Home) map[string]string {
+	names := make(map[string]string)
+	for _, r := range h.Rooms {
+		names[r.Id] = r.Name
+	}
+	return names
+}
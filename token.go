@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	netatmo "github.com/tipok/netatmo_exporter/netatmo-api"
+)
+
+// tokenKeyEnv holds the token keys if no key file is given.
+const tokenKeyEnv = "NETATMO_TOKEN_KEY"
+
+const tokenUsage = `Usage: netatmo_exporter token <command> [flags]
+
+Commands:
+  inspect  show what the token file holds, without its secrets
+  encrypt  encrypt a plaintext token file with the configured key
+`
+
+// tokenStoreFlags select the file the token is kept in and how it is
+// encrypted.
+type tokenStoreFlags struct {
+	tokenFile    string
+	tokenKeyFile string
+}
+
+func (f *tokenStoreFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.tokenFile, "token-file", "", "File keeping the token across restarts, written by the login command")
+	fs.StringVar(&f.tokenKeyFile, "token-key-file", "", "File with the keys encrypting the token file, one per line, the current key first; "+tokenKeyEnv+" is used if not set")
+}
+
+// store returns the token file store, encrypted if keys are configured.
+func (f *tokenStoreFlags) store() (*netatmo.FileTokenStore, error) {
+	if f.tokenFile == "" {
+		return nil, errors.New("token file has to be provided")
+	}
+
+	keys, err := f.keys()
+	if err != nil {
+		return nil, err
+	}
+
+	if keys == nil {
+		return netatmo.NewFileTokenStore(f.tokenFile), nil
+	}
+	return netatmo.NewEncryptedFileTokenStore(f.tokenFile, keys), nil
+}
+
+// keys returns the keys of the token file or nil if none are configured.
+func (f *tokenStoreFlags) keys() (*netatmo.TokenKeys, error) {
+	keys := os.Getenv(tokenKeyEnv)
+	if f.tokenKeyFile != "" {
+		b, err := os.ReadFile(f.tokenKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read token key file: %w", err)
+		}
+		keys = string(b)
+	}
+
+	if keys == "" {
+		return nil, nil
+	}
+	return netatmo.ParseTokenKeys(keys)
+}
+
+func runToken(args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, tokenUsage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch args[0] {
+	case "inspect":
+		err = inspectToken(args[1:])
+	case "encrypt":
+		err = encryptToken(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, tokenUsage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func inspectToken(args []string) error {
+	fs := flag.NewFlagSet("token inspect", flag.ExitOnError)
+	var tf tokenStoreFlags
+	tf.register(fs)
+	parseFlags(fs, args)
+
+	store, err := tf.store()
+	if err != nil {
+		return err
+	}
+
+	stored, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	writeTokenInfo(os.Stdout, stored, time.Now())
+	return nil
+}
+
+// encryptToken encrypts a token file written without a key, so that a key
+// can be introduced without logging in again. The plaintext file is only
+// read here: a store with keys refuses it, so that nobody can swap an
+// encrypted token file for a plaintext one unnoticed.
+func encryptToken(args []string) error {
+	fs := flag.NewFlagSet("token encrypt", flag.ExitOnError)
+	var tf tokenStoreFlags
+	tf.register(fs)
+	parseFlags(fs, args)
+
+	if tf.tokenFile == "" {
+		return errors.New("token file has to be provided")
+	}
+
+	keys, err := tf.keys()
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		return fmt.Errorf("no token key given, use --token-key-file or %s", tokenKeyEnv)
+	}
+
+	plain := netatmo.NewFileTokenStore(tf.tokenFile)
+	encrypted := netatmo.NewEncryptedFileTokenStore(tf.tokenFile, keys)
+	unlock, err := plain.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := encrypted.Load(); err == nil {
+		return fmt.Errorf("token file %s is already encrypted", tf.tokenFile)
+	}
+
+	stored, err := plain.Load()
+	if err != nil {
+		return err
+	}
+
+	if err := encrypted.Save(stored); err != nil {
+		return err
+	}
+	fmt.Printf("Encrypted %s\n", tf.tokenFile)
+	return nil
+}
+
+// writeTokenInfo writes the metadata of t. Access and refresh token are
+// only reported as present or not.
+func writeTokenInfo(w io.Writer, t *netatmo.StoredToken, now time.Time) {
+	scopes := "unknown"
+	if len(t.Scopes) > 0 {
+		scopes = strings.Join(t.Scopes, " ")
+	}
+	fmt.Fprintf(w, "Scopes:        %s\n", scopes)
+	fmt.Fprintf(w, "Obtained at:   %s\n", formatTokenTime(t.ObtainedAt))
+
+	switch {
+	case t.Token.AccessToken == "":
+		fmt.Fprintf(w, "Access token:  none\n")
+	case t.Token.Expiry.IsZero():
+		fmt.Fprintf(w, "Access token:  present, no expiry\n")
+	case t.Token.Expiry.Before(now):
+		fmt.Fprintf(w, "Access token:  expired at %s\n", formatTokenTime(t.Token.Expiry))
+	default:
+		fmt.Fprintf(w, "Access token:  expires at %s (in %s)\n", formatTokenTime(t.Token.Expiry), t.Token.Expiry.Sub(now).Round(time.Second))
+	}
+
+	refresh := "none"
+	if t.Token.RefreshToken != "" {
+		refresh = "present"
+	}
+	fmt.Fprintf(w, "Refresh token: %s\n", refresh)
+}
+
+func formatTokenTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format(time.RFC3339)
+}